@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"math"
+	"net"
 	"os"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/ochipin/config/parser"
 )
@@ -53,33 +58,109 @@ func help() string {
 }
 
 func check(fname string) error {
-	buf, err := ioutil.ReadFile(fname)
+	f, err := os.Open(fname)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	if _, err := parser.Parse(buf); err != nil {
+	if _, err := parser.ParseReader(f); err != nil {
 		return err
 	}
 	return nil
 }
 
 func tojson(fname string) error {
-	buf, err := ioutil.ReadFile(fname)
+	f, err := os.Open(fname)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	p, err := parser.Parse(buf)
+	p, err := parser.ParseReader(f)
 	if err != nil {
 		return err
 	}
 
-	buf, err = json.Marshal(p.Data())
-	if err != nil {
+	var out bytes.Buffer
+	if err := marshal(&out, p, p.Data(), nil); err != nil {
 		return err
 	}
 
-	fmt.Println(string(buf))
+	fmt.Println(out.String())
 	return nil
 }
+
+// 設定ファイルで定義された順序で、キー名を JSON へ出力する
+func marshal(out *bytes.Buffer, p *parser.Parser, value interface{}, path []string) error {
+	data, ok := value.(map[string]interface{})
+	if !ok {
+		buf, err := json.Marshal(jsonValue(value))
+		if err != nil {
+			return err
+		}
+		out.Write(buf)
+		return nil
+	}
+
+	// path が空の場合はモード名、それ以外はテーブルのキー名の一覧
+	var keys []string
+	if len(path) == 0 {
+		// 全体設定領域の _all_ を先頭に、キーを持つモード名を出力する
+		for _, mode := range append([]string{"_all_"}, p.Modes()...) {
+			if _, ok := data[mode]; ok {
+				keys = append(keys, mode)
+			}
+		}
+	} else {
+		keys = p.Keys(path[0], path[1:]...)
+	}
+	out.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		out.Write(name)
+		out.WriteByte(':')
+		if err := marshal(out, p, data[key], append(path[:len(path):len(path)], key)); err != nil {
+			return err
+		}
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+// JSON へ出力する値へ変換する。時間は、ナノ秒の数値ではなく "1m30s" 形式、CIDR は "10.0.0.0/8" 形式、
+// inf, nan は設定ファイルと同じ表記の文字列とする
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case *net.IPNet:
+		return v.String()
+	case float64:
+		// JSON で表現できない inf, nan は、設定ファイルと同じ表記の文字列とする
+		switch {
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		case math.IsNaN(v):
+			return "nan"
+		}
+		return v
+	case encoding.TextMarshaler:
+		return v
+	}
+	// 配列の場合は、各要素を変換する
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return value
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = jsonValue(rv.Index(i).Interface())
+	}
+	return values
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ochipin/config/parser"
+)
+
+// 設定ファイルの内容を、定義された順序の JSON へ変換する
+func TestMarshal(t *testing.T) {
+	var tests = map[string]string{
+		"a = [inf, -inf, nan]\nb = 1.5":                 `{"_all_":{"a":["inf","-inf","nan"],"b":1.5}}`,
+		"a = inf\nb = -inf\nc = nan":                    `{"_all_":{"a":"inf","b":"-inf","c":"nan"}}`,
+		"t = 30s\nts = [100ms, 1.5s]":                   `{"_all_":{"t":"30s","ts":["100ms","1.5s"]}}`,
+		"c = 10.0.0.0/8\nip = ::1":                      `{"_all_":{"c":"10.0.0.0/8","ip":"::1"}}`,
+		"z = 1\n[empty]\n[prod]\nb = 2\n[_all_]\na = 3": `{"_all_":{"z":1,"a":3},"prod":{"b":2}}`,
+	}
+	for conf, expect := range tests {
+		p, err := parser.ParseReader(strings.NewReader(conf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := marshal(&out, p, p.Data(), nil); err != nil {
+			t.Fatalf("%q: %v", conf, err)
+		}
+		if out.String() != expect {
+			t.Errorf("%q: %s != %s", conf, out.String(), expect)
+		}
+	}
+}
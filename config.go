@@ -1,21 +1,24 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
+	"os"
 	"reflect"
 
+	"github.com/ochipin/config/internal/lookup"
 	"github.com/ochipin/config/parser"
 )
 
-// mapにデータを追加/上書きする
-func setdata(all map[string]interface{}, data interface{}, keys []string) {
+// mapにデータを追加/上書きする。fold が true の場合は、大文字、小文字を区別せずにキー名を対応付ける
+func setdata(all map[string]interface{}, data interface{}, keys []string, fold bool) {
 	// app.key.name ---> [app key], [name] の2つへ分離
 	last := keys[len(keys)-1]
 	keys = keys[:len(keys)-1]
 	// [app key] キーの値のみ検証
 	for _, key := range keys {
+		key = lookup.Key(all, key, fold)
 		if v, ok := all[key].(map[string]interface{}); ok {
 			// data[key] が map の場合、次の要素へ
 			all = v
@@ -26,21 +29,21 @@ func setdata(all map[string]interface{}, data interface{}, keys []string) {
 		}
 	}
 	// 最後に、data[app][key][name] = data とする
-	all[last] = data
+	all[lookup.Key(all, last, fold)] = data
 }
 
 // map1にmap2をマージする。既に存在する要素がある場合、上書きを実施する
-func mergedata(map1, map2 map[string]interface{}, keys ...string) {
+func mergedata(map1, map2 map[string]interface{}, fold bool, keys ...string) {
 	// マージしたいデータをループで全データを処理
 	// map[app][key][name] = "merge"
 	for key, value := range map2 {
 		keys = append(keys, key)
 		if v, ok := value.(map[string]interface{}); ok {
 			// map[app] も map の場合、再帰する
-			mergedata(map1, v, keys...)
+			mergedata(map1, v, fold, keys...)
 		} else {
 			// 終端にたどり着いた時点で、データをマージする
-			setdata(map1, value, keys)
+			setdata(map1, value, keys, fold)
 		}
 		if len(keys) > 0 {
 			keys = keys[:len(keys)-1]
@@ -49,7 +52,7 @@ func mergedata(map1, map2 map[string]interface{}, keys ...string) {
 }
 
 // パースしたデータを構造体に格納する
-func unmarshal(data map[string]interface{}, i interface{}) error {
+func unmarshal(data map[string]interface{}, i interface{}, o *options) error {
 	// パースデータ格納用変数がnilの場合、エラーとする
 	if i == nil {
 		return fmt.Errorf("unmarshal error. missing arguments")
@@ -61,40 +64,60 @@ func unmarshal(data map[string]interface{}, i interface{}) error {
 		return fmt.Errorf("unmarshal error. missing arguments")
 	}
 
-	// パースするデータを格納する領域が、 &map[string]... の場合
-	if valueof.Elem().Kind() == reflect.Map && valueof.Elem().Type().Key().Kind() == reflect.String {
-		// リフレクションを使用してデータを格納して復帰する
-		valueof.Elem().Set(reflect.ValueOf(data))
-		return nil
-	}
+	// リフレクションを使用してデータを格納する
+	return decode(data, valueof.Elem(), "", o)
+}
 
-	buf, _ := json.Marshal(data)
-	if err := json.Unmarshal(buf, i); err != nil {
-		if err, ok := err.(*json.UnmarshalTypeError); ok {
-			if err.Struct != "" || err.Field != "" {
-				return fmt.Errorf("marshal error: " + err.Value + " into struct field " + err.Struct + "." + err.Field + " of type " + err.Type.String())
-			}
-		}
-		return fmt.Errorf("marshal error: %s", err)
+// Parse は、指定した設定ファイルの内容をパースし、構造体、またはマップに格納する
+func Parse(path, mode string, i interface{}, opts ...Option) error {
+	// 指定されたパスから、設定ファイルを一定のサイズ毎に読み込む。parser.MaxInputSize の上限を超えた時点で中止する
+	f, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+	return ParseReader(f, mode, i, opts...)
+}
 
-	return nil
+// ParseBytes は、設定ファイルの内容をパースし、構造体、またはマップに格納する
+func ParseBytes(buf []byte, mode string, i interface{}, opts ...Option) error {
+	return parse(buf, mode, i, newOptions(opts))
 }
 
-// Parse は、指定した設定ファイルの内容をパースし、構造体、またはマップに格納する
-func Parse(path, mode string, i interface{}) error {
-	// 指定されたパスから、設定ファイルを読み込む
-	buf, err := ioutil.ReadFile(path)
+// ParseReader は、r から読み込んだ設定ファイルの内容をパースし、構造体、またはマップに格納する
+func ParseReader(r io.Reader, mode string, i interface{}, opts ...Option) error {
+	o := newOptions(opts)
+	// 一定のサイズ毎に読み込みながら、map[string]interface{} へパースする
+	p, err := parser.ParseReader(r, o.parser...)
+	if err != nil {
+		return o.error(err)
+	}
+	return store(p, mode, i, o)
+}
+
+// ParseFS は、fsys 内の設定ファイルの内容をパースし、構造体、またはマップに格納する。
+// Filename オプションの指定がない場合、エラーメッセージには path を付与する
+func ParseFS(fsys fs.FS, path, mode string, i interface{}, opts ...Option) error {
+	f, err := fsys.Open(path)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+	return ParseReader(f, mode, i, append([]Option{Filename(path)}, opts...)...)
+}
 
+// 設定ファイルの内容をパースし、構造体、またはマップに格納する
+func parse(buf []byte, mode string, i interface{}, o *options) error {
 	// 読み込んだ設定ファイル内容を map[string]interface{} へパースする
-	p, err := parser.Parse(buf)
+	p, err := parser.Parse(buf, o.parser...)
 	if err != nil {
-		return err
+		return o.error(err)
 	}
+	return store(p, mode, i, o)
+}
 
+// パースした設定ファイルの内容を、構造体、またはマップに格納する
+func store(p *parser.Parser, mode string, i interface{}, o *options) error {
 	// パース内容を変数へ格納
 	data := p.Data().(map[string]interface{})
 
@@ -102,27 +125,37 @@ func Parse(path, mode string, i interface{}) error {
 	_, ok1 := data["_all_"]
 	_, ok2 := data[mode]
 
-	if ok1 && ok2 {
-		// 全体設定領域、マージデータ双方存在する場合は、データをインターフェースへ格納する
-		all := data["_all_"].(map[string]interface{})
-		mrg := data[mode].(map[string]interface{})
-		mergedata(all, mrg)
-		return unmarshal(all, i)
-	} else if ok1 {
-		// 全体設定領域しか存在しない場合、全体設定領域のみをインターフェースへ格納する
-		return unmarshal(data["_all_"].(map[string]interface{}), i)
-	} else if ok2 {
-		// マージデータしか存在しない場合、マージデータのみをインターフェースへ格納する
-		return unmarshal(data[mode].(map[string]interface{}), i)
+	// データが存在しない場合、エラーを返却する
+	if !ok1 && !ok2 {
+		return o.error(fmt.Errorf("no configuration"))
 	}
 
-	// データが存在しない場合、エラーを返却する
-	return fmt.Errorf("no configuration")
+	// 全体設定領域、モードの順にマージする
+	file := make(map[string]interface{})
+	if ok1 {
+		mergedata(file, data["_all_"].(map[string]interface{}), !o.caseSensitive)
+	}
+	if ok2 {
+		mergedata(file, data[mode].(map[string]interface{}), !o.caseSensitive)
+	}
+	// 構造体の default タグから既定値を生成し、設定ファイルの内容で上書きする
+	all, err := defaults(file, i, o)
+	if err != nil {
+		return err
+	}
+	mergedata(all, file, !o.caseSensitive)
+	// 必須キーが存在するかチェックする
+	if err := checkrequired(all, i, o, mode); err != nil {
+		return o.error(err)
+	}
+	return unmarshal(all, i, o)
 }
 
 // Config : 設定ファイル操作構造体
 type Config struct {
-	data map[string]interface{}
+	data     map[string]interface{}
+	modes    []string
+	warnings []parser.Warning
 }
 
 // DataAll : 登録されている全データを取得する
@@ -138,30 +171,84 @@ func (c *Config) Data(mode string) map[string]interface{} {
 	return nil
 }
 
-// Unmarshal : 構造体、またはマップにデータを格納する
-func (c *Config) Unmarshal(data map[string]interface{}, i interface{}) error {
-	return unmarshal(data, i)
+// Modes : 設定ファイルで宣言されたモード名を、定義された順序で取得する。全体設定領域の _all_ は含まない
+func (c *Config) Modes() []string {
+	return c.modes
+}
+
+// Warnings : parser.LastWins, parser.FirstWins オプション指定時に、重複して定義されたキー名の一覧を取得する
+func (c *Config) Warnings() []parser.Warning {
+	return c.warnings
+}
+
+// Unmarshal : 構造体、またはマップにデータを格納する。構造体の default タグで指定された既定値は、data で上書きされる
+func (c *Config) Unmarshal(data map[string]interface{}, i interface{}, opts ...Option) error {
+	o := newOptions(opts)
+	all, err := defaults(data, i, o)
+	if err != nil {
+		return err
+	}
+	mergedata(all, data, !o.caseSensitive)
+	if err := checkrequired(all, i, o, ""); err != nil {
+		return err
+	}
+	return unmarshal(all, i, o)
 }
 
 // Merge : データ1にデータ2をマージする
 func (c *Config) Merge(data1, data2 map[string]interface{}) {
-	mergedata(data1, data2)
+	mergedata(data1, data2, false)
 }
 
 // ParseMode 関数は、設定ファイル内容を解析、パースする。冒頭にモード指定がされていないと設定ファイルを解析しない
-func ParseMode(path string) (*Config, error) {
-	// 指定されたパスから、設定ファイルを読み込む
-	buf, err := ioutil.ReadFile(path)
+func ParseMode(path string, opts ...Option) (*Config, error) {
+	// 指定されたパスから、設定ファイルを一定のサイズ毎に読み込む。parser.MaxInputSize の上限を超えた時点で中止する
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+	return ParseModeReader(f, opts...)
+}
 
-	// 読み込んだ設定ファイル内容を map[string]interface{} へパースする
-	p, err := parser.ParseModeAll(buf)
+// ParseModeBytes 関数は、設定ファイル内容を解析、パースする。冒頭にモード指定がされていないと設定ファイルを解析しない
+func ParseModeBytes(buf []byte, opts ...Option) (*Config, error) {
+	return parseMode(buf, newOptions(opts))
+}
+
+// ParseModeReader 関数は、r から読み込んだ設定ファイル内容を解析、パースする。冒頭にモード指定がされていないと設定ファイルを解析しない
+func ParseModeReader(r io.Reader, opts ...Option) (*Config, error) {
+	o := newOptions(opts)
+	// 一定のサイズ毎に読み込みながら、map[string]interface{} へパースする
+	p, err := parser.ParseModeAllReader(r, o.parser...)
+	if err != nil {
+		return nil, o.error(err)
+	}
+	return newConfig(p), nil
+}
+
+// ParseModeFS 関数は、fsys 内の設定ファイル内容を解析、パースする。冒頭にモード指定がされていないと設定ファイルを解析しない。
+// Filename オプションの指定がない場合、エラーメッセージには path を付与する
+func ParseModeFS(fsys fs.FS, path string, opts ...Option) (*Config, error) {
+	f, err := fsys.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+	return ParseModeReader(f, append([]Option{Filename(path)}, opts...)...)
+}
+
+// 設定ファイル内容を解析し、設定ファイル操作構造体を返却する
+func parseMode(buf []byte, o *options) (*Config, error) {
+	// 読み込んだ設定ファイル内容を map[string]interface{} へパースする
+	p, err := parser.ParseModeAll(buf, o.parser...)
+	if err != nil {
+		return nil, o.error(err)
+	}
+	return newConfig(p), nil
+}
 
-	// 設定ファイルパース内容を操作する構造体を返却する
-	return &Config{p.Data().(map[string]interface{})}, nil
+// 設定ファイルパース内容を操作する構造体を返却する
+func newConfig(p *parser.Parser) *Config {
+	return &Config{data: p.Data().(map[string]interface{}), modes: p.Modes(), warnings: p.Warnings()}
 }
@@ -2,7 +2,19 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ochipin/config/parser"
 )
 
 type ConfigTest struct {
@@ -88,6 +100,9 @@ func TestConfigMode(t *testing.T) {
 	if p.Data("nodata") != nil {
 		t.Fatal("p.Data() is error")
 	}
+	if fmt.Sprint(p.Modes()) != "[config]" {
+		t.Fatal("p.Modes() is error", p.Modes())
+	}
 
 	p, err = ParseMode("test/normal_test2.conf")
 	if err != nil {
@@ -103,3 +118,684 @@ func TestConfigMode(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type DefaultTest struct {
+	Http struct {
+		Host    string   `default:"localhost"`
+		Port    int      `default:"8080"`
+		Timeout int64    `default:"30s"`
+		Servers []string `default:"[\"a.example.com\", \"b.example.com\"]"`
+		Name    string   `json:"server_name" default:"'default'"`
+	}
+}
+
+func TestConfigDefault(t *testing.T) {
+	var conf DefaultTest
+	if err := Parse("test/normal_test7.conf", "development", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Http.Host != "localhost" || conf.Http.Port != 8081 || conf.Http.Timeout != 30000 {
+		t.Fatal("default value error", conf)
+	}
+	if fmt.Sprint(conf.Http.Servers) != "[a.example.com b.example.com]" || conf.Http.Name != "default" {
+		t.Fatal("default value error", conf)
+	}
+	// モードの設定値が、既定値より優先される
+	conf = DefaultTest{}
+	if err := Parse("test/normal_test7.conf", "production", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Http.Host != "example.com" || conf.Http.Port != 8081 {
+		t.Fatal("default value error", conf)
+	}
+
+	// Unmarshal でも既定値が適用される
+	p, err := ParseMode("test/normal_test2.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf = DefaultTest{}
+	if err := p.Unmarshal(p.Data("config1"), &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Http.Host != "localhost" || conf.Http.Port != 8080 {
+		t.Fatal("default value error", conf)
+	}
+
+	// 不正な既定値の場合はエラーとする
+	var ng struct {
+		Port int `default:"80 80"`
+	}
+	if err := Parse("test/normal_test7.conf", "development", &ng); err == nil {
+		t.Fatal("invalid default value")
+	}
+	// 既定値から、別のキーを定義することはできない
+	var ng2 struct {
+		Port int `default:"1\nother = 2"`
+	}
+	err = Parse("test/normal_test7.conf", "development", &ng2)
+	if err == nil || err.Error() != `default value error: "port" syntax error: "1\nother = 2" is not a single value` {
+		t.Fatal(err)
+	}
+}
+
+type RequiredTest struct {
+	Http struct {
+		Host string `required:"true"`
+		Port int    `required:"true"`
+	}
+	Db struct {
+		Host string
+		User string `required:"false"`
+	}
+}
+
+func TestConfigRequired(t *testing.T) {
+	var conf RequiredTest
+	// http.host が存在しない場合、エラーとする
+	err := Parse("test/normal_test7.conf", "development", &conf, Require("db.host", "DB.Port"))
+	if err == nil {
+		t.Fatal("required test failed")
+	}
+	if err.Error() != `missing required keys in "development" mode: http.host, db.host, db.port` {
+		t.Fatal(err)
+	}
+	// モードを切り替えた場合は、http.host が存在する
+	if err := Parse("test/normal_test7.conf", "production", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Http.Host != "example.com" || conf.Http.Port != 8081 {
+		t.Fatal("required test failed", conf)
+	}
+
+	p, err := ParseMode("test/normal_test2.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data = make(map[string]interface{})
+	if err := p.Unmarshal(p.Data("config1"), &data, Require("http.port")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unmarshal(p.Data("config1"), &data, Require("http.port.number")); err == nil {
+		t.Fatal("required test failed")
+	}
+}
+
+// ポインタの構造体フィールドは、省略可能なセクションとして扱う
+func TestConfigOptionalSection(t *testing.T) {
+	type section struct {
+		Host string `required:"true"`
+		Port int    `default:"443"`
+	}
+	type conf struct {
+		Http  section
+		Http2 *section
+	}
+	// セクションが存在しない場合、配下の required, default タグは使用しない
+	var c conf
+	err := Parse("test/normal_test7.conf", "production", &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Http.Host != "example.com" || c.Http.Port != 8081 || c.Http2 != nil {
+		t.Fatal("optional section test failed", c)
+	}
+
+	// セクションが存在する場合は、required, default タグを使用する
+	var p = &Config{}
+	err = p.Unmarshal(map[string]interface{}{
+		"http":  map[string]interface{}{"host": "a"},
+		"http2": map[string]interface{}{"port": 8443},
+	}, &c)
+	if err == nil || err.Error() != "missing required keys: http2.host" {
+		t.Fatal(err)
+	}
+	c = conf{}
+	err = p.Unmarshal(map[string]interface{}{
+		"http":  map[string]interface{}{"host": "a"},
+		"http2": map[string]interface{}{"host": "b"},
+	}, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Http.Port != 443 || c.Http2 == nil || c.Http2.Host != "b" || c.Http2.Port != 443 {
+		t.Fatal("optional section test failed", c)
+	}
+}
+
+type LogLevel int
+
+func (level *LogLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "info":
+		*level = 1
+	case "warn":
+		*level = 2
+	default:
+		return fmt.Errorf("unknown level %s", text)
+	}
+	return nil
+}
+
+type Release struct {
+	Year int
+}
+
+func (r *Release) UnmarshalConfig(value interface{}) error {
+	v, ok := value.(time.Time)
+	if !ok {
+		return fmt.Errorf("release is not datetime")
+	}
+	r.Year = v.Year()
+	return nil
+}
+
+type upper string
+
+func (s *upper) UnmarshalText(text []byte) error {
+	*s = upper(strings.ToUpper(string(text)))
+	return nil
+}
+
+type UnmarshalerTest struct {
+	App struct {
+		Addr    net.IP
+		URL     *url.URL
+		Name    upper
+		Level   LogLevel
+		Release Release
+		Ports   [2]uint16
+	}
+}
+
+func TestConfigUnmarshaler(t *testing.T) {
+	var conf UnmarshalerTest
+	if err := Parse("test/normal_test8.conf", "development", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.App.Addr.String() != "192.168.0.1" || conf.App.URL.Host != "example.com" {
+		t.Fatal("unmarshaler test failed", conf)
+	}
+	if conf.App.Name != "WEB" || conf.App.Level != 2 || conf.App.Release.Year != 2018 {
+		t.Fatal("unmarshaler test failed", conf)
+	}
+	if conf.App.Ports != [2]uint16{8080, 8081} {
+		t.Fatal("unmarshaler test failed", conf)
+	}
+
+	// エラーは、キー名とともに返却する
+	var ng struct {
+		App struct {
+			Level   LogLevel `json:"addr"`
+			Release Release  `json:"url"`
+			Ports   []int8
+		}
+	}
+	err := Parse("test/normal_test8.conf", "development", &ng)
+	if err == nil || !strings.Contains(err.Error(), `"app.`) {
+		t.Fatal("unmarshaler test failed", err)
+	}
+	var ng2 struct {
+		App struct {
+			Ports []int8
+		}
+	}
+	err = Parse("test/normal_test8.conf", "development", &ng2)
+	if err == nil || err.Error() != `marshal error: "app.ports[0]" 8080 overflows int8` {
+		t.Fatal("unmarshaler test failed", err)
+	}
+}
+
+type NetworkTest struct {
+	Http struct {
+		Listen string
+		Addr   net.IP
+		Allow  []net.IPNet
+		Deny   *net.IPNet
+		Dns    []net.IP
+	}
+}
+
+func TestConfigNetwork(t *testing.T) {
+	var conf NetworkTest
+	if err := Parse("test/normal_test9.conf", "development", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Http.Listen != "0.0.0.0:8080" || !conf.Http.Addr.Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatal("network test failed", conf)
+	}
+	if len(conf.Http.Allow) != 2 || !conf.Http.Allow[1].Contains(net.ParseIP("192.168.1.1")) {
+		t.Fatal("network test failed", conf)
+	}
+	if conf.Http.Deny.String() != "172.16.0.0/12" || fmt.Sprint(conf.Http.Dns) != "[8.8.8.8 2001:4860:4860::8888]" {
+		t.Fatal("network test failed", conf)
+	}
+
+	// IPアドレスは、文字列型のフィールドにも格納できる
+	var str struct {
+		Http struct {
+			Addr string
+		}
+	}
+	if err := Parse("test/normal_test9.conf", "development", &str); err != nil {
+		t.Fatal(err)
+	}
+	if str.Http.Addr != "10.0.0.1" {
+		t.Fatal("network test failed", str)
+	}
+}
+
+func TestConfigParserOptions(t *testing.T) {
+	var conf struct {
+		App struct {
+			Release time.Time
+			Start   time.Time `default:"2018-01-01"`
+		}
+	}
+	jst := time.FixedZone("JST", 9*60*60)
+	if err := Parse("test/normal_test8.conf", "development", &conf, ParserOptions(parser.Location(jst))); err != nil {
+		t.Fatal(err)
+	}
+	if conf.App.Release.String() != "2018-03-10 14:32:11 +0900 JST" || conf.App.Start.String() != "2018-01-01 00:00:00 +0900 JST" {
+		t.Fatal("parser options test failed", conf)
+	}
+	// 上限を超える設定ファイルは、読み込みを中止する
+	limit := ParserOptions(parser.MaxInputSize(16))
+	if err := Parse("test/normal_test8.conf", "development", &conf, limit); err == nil || err.Error() != "syntax error: input size exceeds the limit of 16 bytes" {
+		t.Fatal(err)
+	}
+	if _, err := ParseMode("test/normal_test8.conf", limit); err == nil || err.Error() != "syntax error: input size exceeds the limit of 16 bytes" {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigDuration(t *testing.T) {
+	var conf struct {
+		Http struct {
+			Timeout  time.Duration   `default:"1m30s"`
+			Interval int64           `default:"1.5s"`
+			Ratio    float64         `default:"250us"`
+			Retry    []time.Duration `default:"[100ms, 1s]"`
+		}
+	}
+	if err := Parse("test/normal_test7.conf", "development", &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Http.Timeout != 90*time.Second || conf.Http.Interval != 1500 || conf.Http.Ratio != 0.25 {
+		t.Fatal("duration test failed", conf)
+	}
+	if fmt.Sprint(conf.Http.Retry) != "[100ms 1s]" {
+		t.Fatal("duration test failed", conf)
+	}
+	// ミリ秒で表現できない時間は、整数型へ格納できない
+	var ng struct {
+		Http struct {
+			Interval int64 `default:"1500us"`
+		}
+	}
+	if err := Parse("test/normal_test7.conf", "development", &ng); err == nil {
+		t.Fatal("duration test failed")
+	}
+}
+
+// 64bit 整数、任意精度の数値の格納テスト
+func TestConfigNumeric(t *testing.T) {
+	var conf struct {
+		Stats struct {
+			Counter uint64
+			Total   big.Int
+			Ratio   *big.Rat
+			Limit   uint8
+			Upper   float64
+			Exact   big.Float `default:"0.1"`
+		}
+	}
+	if err := Parse("test/normal_test10.conf", "", &conf, ParserOptions(parser.ExactNumbers())); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Stats.Counter != math.MaxUint64 || conf.Stats.Limit != 255 || !math.IsInf(conf.Stats.Upper, 1) {
+		t.Fatal("numeric test failed", conf.Stats)
+	}
+	if conf.Stats.Total.String() != "123456789012345678901234567890" || conf.Stats.Ratio.String() != "1/10" {
+		t.Fatal("numeric test failed", conf.Stats)
+	}
+	if conf.Stats.Exact.Text('g', 20) != "0.1" {
+		t.Fatal("numeric test failed", conf.Stats.Exact.Text('g', 20))
+	}
+
+	// ExactNumbers オプション未指定の場合、uint64 の範囲を超える整数はエラーとする
+	if err := Parse("test/normal_test10.conf", "", &conf); err == nil {
+		t.Fatal("numeric test failed")
+	}
+	// 格納先の型の範囲を超える値はエラーとする
+	var ng struct {
+		Stats struct {
+			Counter int64
+		}
+	}
+	if err := Parse("test/normal_test10.conf", "", &ng, ParserOptions(parser.ExactNumbers())); err == nil {
+		t.Fatal("numeric test failed")
+	}
+}
+
+// キー名の大文字、小文字を保持するオプションのテスト
+func TestConfigKeyCase(t *testing.T) {
+	type conf struct {
+		App struct {
+			Name string `required:"true"`
+		}
+		Headers map[string]string
+	}
+	// 大文字、小文字を保持し、構造体のフィールドとは区別せずに対応付ける
+	var c1 conf
+	if err := Parse("test/normal_test11.conf", "production", &c1, PreserveCase()); err != nil {
+		t.Fatal(err)
+	}
+	if c1.App.Name != "prod" || fmt.Sprint(c1.Headers) != "map[Content-Type:json X-Request-ID:id]" {
+		t.Fatal("key case test failed", c1)
+	}
+	// 大文字、小文字を区別する場合は、App.Name はフィールドに対応付けない
+	var c2 conf
+	err := Parse("test/normal_test11.conf", "development", &c2, CaseSensitive())
+	if err == nil || err.Error() != "missing required keys in \"development\" mode: app.name" {
+		t.Fatal(err)
+	}
+	// json タグで指定した名前とは、大文字、小文字を区別して対応付ける
+	var c3 struct {
+		App struct {
+			Name string
+		}
+		Headers map[string]string `json:"Headers"`
+	}
+	if err := Parse("test/normal_test11.conf", "production", &c3, CaseSensitive()); err != nil {
+		t.Fatal(err)
+	}
+	if c3.App.Name != "prod" || fmt.Sprint(c3.Headers) != "map[Content-Type:json X-Request-ID:id]" {
+		t.Fatal("key case test failed", c3)
+	}
+}
+
+func TestConfigDuplicate(t *testing.T) {
+	// 既定では、キー名の重複はエラーとなる
+	if _, err := ParseMode("test/normal_test12.conf"); err == nil || err.Error() != `syntax error:6: "http.port" already exists` {
+		t.Fatal(err)
+	}
+	// 後から定義した値で上書きする
+	p, err := ParseMode("test/normal_test12.conf", ParserOptions(parser.LastWins()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Data("production")) != "map[http:map[host:example.com port:443]]" {
+		t.Fatal(p.Data("production"))
+	}
+	if fmt.Sprint(p.Warnings()) != `[warning:6: "http.port" overrides the definition at line 3]` {
+		t.Fatal(p.Warnings())
+	}
+	// 先に定義した値を使用する
+	p, err = ParseMode("test/normal_test12.conf", ParserOptions(parser.FirstWins()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Data("production")) != "map[http:map[host:example.com port:80]]" {
+		t.Fatal(p.Data("production"))
+	}
+	if w := p.Warnings(); len(w) != 1 || w[0].Mode != "production" || w[0].Line != 6 || w[0].Previous != 3 || !w[0].Ignored {
+		t.Fatal(w)
+	}
+}
+
+func TestConfigSources(t *testing.T) {
+	var conf = "app.name = \"global\"\n[production]\napp.name = \"prod\"\n"
+	var fsys = fstest.MapFS{
+		"conf/app.conf":   {Data: []byte(conf)},
+		"conf/error.conf": {Data: []byte("app.name = \"a\"\napp.flag = yes\n")},
+	}
+	// バイト列、io.Reader、fs.FS のいずれからも同じ結果を取得できる
+	var sources = map[string]func(*ConfigTest) error{
+		"bytes": func(c *ConfigTest) error {
+			return ParseBytes([]byte(conf), "production", c)
+		},
+		"reader": func(c *ConfigTest) error {
+			return ParseReader(strings.NewReader(conf), "production", c)
+		},
+		"fs": func(c *ConfigTest) error {
+			return ParseFS(fsys, "conf/app.conf", "production", c)
+		},
+	}
+	for name, fn := range sources {
+		var c ConfigTest
+		if err := fn(&c); err != nil || c.App.Name != "prod" {
+			t.Errorf("%s: %v %v", name, c, err)
+		}
+	}
+	// fs.FS から読み込んだ場合は、エラーメッセージにパスを付与する
+	var c ConfigTest
+	err := ParseFS(fsys, "conf/error.conf", "production", &c)
+	if err == nil || err.Error() != `conf/error.conf: syntax error:2: "app.flag" invalid value` {
+		t.Fatal(err)
+	}
+	err = ParseReader(strings.NewReader("app.flag = yes"), "production", &c, Filename("<stdin>"))
+	if err == nil || err.Error() != `<stdin>: syntax error:1: "app.flag" invalid value` {
+		t.Fatal(err)
+	}
+	if err := ParseFS(fsys, "conf/noconf", "production", &c); err == nil {
+		t.Fatal(err)
+	}
+	if err := ParseFS(os.DirFS("test"), "normal_test6.conf", "config", &c); err != nil || c.App.Name != "test" {
+		t.Fatal(c, err)
+	}
+
+	// モード名の指定が必要な場合
+	var modes = map[string]func() (*Config, error){
+		"bytes": func() (*Config, error) {
+			return ParseModeBytes([]byte(conf))
+		},
+		"reader": func() (*Config, error) {
+			return ParseModeReader(strings.NewReader(conf))
+		},
+		"fs": func() (*Config, error) {
+			return ParseModeFS(fsys, "conf/app.conf")
+		},
+	}
+	for name, fn := range modes {
+		if _, err := fn(); err == nil || !strings.HasSuffix(err.Error(), "syntax error:1: mode name is empty") {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	p, err := ParseModeFS(fsys, "conf/app.conf", Filename("app.conf"))
+	if err == nil || err.Error() != "app.conf: syntax error:1: mode name is empty" {
+		t.Fatal(p, err)
+	}
+	p, err = ParseModeReader(strings.NewReader(conf[len("app.name = \"global\"\n"):]))
+	if err != nil || fmt.Sprint(p.DataAll()) != "map[production:map[app:map[name:prod]]]" {
+		t.Fatal(p, err)
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	// inotify、ポーリングのいずれでも、変更を検知して再読み込みする
+	for _, opts := range [][]Option{nil, {PollInterval(10 * time.Millisecond)}} {
+		path := filepath.Join(t.TempDir(), "app.conf")
+		if err := os.WriteFile(path, []byte("app.name = \"a\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var c ConfigTest
+		w, err := NewWatcher(path, "production", &c, opts...)
+		if err != nil || c.App.Name != "a" || w.Load() != &c {
+			t.Fatal(c, err)
+		}
+		changes := make(chan [2]*ConfigTest, 10)
+		failures := make(chan error, 10)
+		w.OnChange(func(old, new interface{}) {
+			changes <- [2]*ConfigTest{old.(*ConfigTest), new.(*ConfigTest)}
+		})
+		w.OnError(func(err error) {
+			failures <- err
+		})
+		// 書き込み途中の内容で解析に失敗した場合は、次の変更を待つ
+		wait := func(name string) {
+			t.Helper()
+			for {
+				select {
+				case v := <-changes:
+					if v[1].App.Name != name {
+						continue
+					}
+					if w.Load() != v[1] || v[0].App.Name == name {
+						t.Fatal(v[0], v[1], w.Load())
+					}
+					return
+				case <-failures:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("%v: %s not reloaded", opts, name)
+				}
+			}
+		}
+
+		// 上書きした場合
+		if err := os.WriteFile(path, []byte("app.name = \"bb\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		wait("bb")
+		// 解析に失敗した場合は、以前の値を保持する
+		if err := os.WriteFile(path, []byte("app.name = \"ccc\"\napp.flag = yes\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-failures:
+			if !strings.Contains(err.Error(), "syntax error") {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: error not reported", opts)
+		}
+		if name := w.Load().(*ConfigTest).App.Name; name != "bb" {
+			t.Fatal(name)
+		}
+		if err := w.Err(); err == nil || !strings.Contains(err.Error(), "syntax error") {
+			t.Fatal(err)
+		}
+		// 別のファイルで置き換えた場合
+		tmp := filepath.Join(filepath.Dir(path), "app.conf.tmp")
+		if err := os.WriteFile(tmp, []byte("app.name = \"dddd\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+		wait("dddd")
+		// 変更がなくても、再読み込みできる
+		if err := w.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if v := <-changes; v[0] == v[1] || v[1].App.Name != "dddd" || w.Load() != v[1] {
+			t.Fatal(v[0], v[1], w.Load())
+		}
+		w.Close()
+		w.Close()
+	}
+
+	var c ConfigTest
+	if _, err := NewWatcher("test/normal_test6.conf", "config", c); err == nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWatcher("test/noconf", "config", &c); err == nil {
+		t.Fatal(err)
+	}
+}
+
+// 空の配列等、nil の値はゼロ値として格納する
+func TestConfigNilValue(t *testing.T) {
+	type T struct{ B int }
+	var tests = map[string]interface{}{
+		"[]int":       &struct{ A []int }{A: []int{1}},
+		"*T":          &struct{ A *T }{A: &T{B: 1}},
+		"map":         &struct{ A map[string]int }{A: map[string]int{"b": 1}},
+		"interface{}": &struct{ A interface{} }{A: 1},
+		"int":         &struct{ A int }{A: 1},
+		"string":      &struct{ A string }{A: "a"},
+		"[1]int":      &struct{ A [1]int }{A: [1]int{1}},
+		"struct":      &struct{ A T }{A: T{B: 1}},
+		"Duration":    &struct{ A time.Duration }{A: 1},
+		"IP":          &struct{ A net.IP }{A: net.IPv4(127, 0, 0, 1)},
+		"IPNet":       &struct{ A *net.IPNet }{A: &net.IPNet{}},
+		"big.Int":     &struct{ A big.Int }{A: *big.NewInt(1)},
+		"Time":        &struct{ A time.Time }{A: time.Now()},
+	}
+	for name, i := range tests {
+		if err := ParseBytes([]byte("a = []\n"), "", i); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		v := reflect.ValueOf(i).Elem().Field(0)
+		if !v.IsZero() {
+			t.Errorf("%s: %v", name, v)
+		}
+	}
+
+	var m map[string]interface{}
+	if err := ParseBytes([]byte("a = []\nb = 1\n"), "", &m); err != nil || fmt.Sprint(m) != "map[a:<nil> b:1]" {
+		t.Fatal(m, err)
+	}
+	var c Config
+	var conf struct{ A []int }
+	if err := c.Unmarshal(map[string]interface{}{"a": nil}, &conf); err != nil || conf.A != nil {
+		t.Fatal(conf, err)
+	}
+}
+
+// どのような設定ファイルでも、構造体、マップへの格納で panic しない
+func FuzzConfig(f *testing.F) {
+	files, _ := filepath.Glob("test/*.conf")
+	for _, file := range files {
+		if buf, err := os.ReadFile(file); err == nil {
+			f.Add(buf)
+		}
+	}
+	for _, seed := range []string{
+		"a = []",
+		"a = [[], [1]]\nb = {}",
+		"[config]\napp.name = 1\napp.flag = \"x\"\nhttp.log = [1]",
+		"a = 1s\nb = 1KB\nc = 10.0.0.0/8\nd = ::1\ne = 2018-03-20\nf = 1e400",
+		"a.b = 18446744073709551616\nc = -1\nd = nan",
+	} {
+		f.Add([]byte(seed))
+	}
+	type T struct {
+		A  int
+		B  []string
+		C  map[string]interface{}
+		D  *net.IPNet
+		E  time.Time
+		F  time.Duration
+		G  [2]uint8
+		H  interface{}
+		I  *big.Int
+		J  net.IP
+		K  *upper
+		L  *url.URL
+		M  float32
+		N  struct{ A, B []int }
+		Z  []*T
+		AB map[string][]int
+	}
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		var c ConfigTest
+		ParseBytes(buf, "config", &c)
+		var v T
+		ParseBytes(buf, "config", &v)
+		var m map[string]interface{}
+		ParseBytes(buf, "config", &m)
+		conf, err := ParseModeBytes(buf)
+		if err != nil {
+			return
+		}
+		for _, mode := range conf.Modes() {
+			var v T
+			conf.Unmarshal(conf.Data(mode), &v)
+		}
+	})
+}
@@ -0,0 +1,417 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unmarshaler : 設定値を独自に解析する型が実装するインターフェース。
+// value には、パースした値 (string, int, float64, bool, time.Time, time.Duration, スライス, map[string]interface{}) がそのまま渡される
+type Unmarshaler interface {
+	UnmarshalConfig(value interface{}) error
+}
+
+var (
+	typeUnmarshaler     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	typeURL             = reflect.TypeOf(url.URL{})
+	typeBigInt          = reflect.TypeOf(big.Int{})
+	typeBigFloat        = reflect.TypeOf(big.Float{})
+	typeBigRat          = reflect.TypeOf(big.Rat{})
+)
+
+// 値を格納できない場合のエラーを生成する
+func typeerror(value interface{}, rv reflect.Value, key string) error {
+	return fmt.Errorf("marshal error: %s value into \"%s\" of type %s", reflect.TypeOf(value), key, rv.Type())
+}
+
+// キー名を連結する
+func joinkey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// パースした値 value を、rv へ格納する。key はエラー表示に使用するキー名
+func decode(value interface{}, rv reflect.Value, key string, o *options) error {
+	// 空の配列等、値が nil の場合はゼロ値とする
+	if value == nil {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	// ポインタの場合は、領域を確保して要素へ格納する
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decode(value, rv.Elem(), key, o)
+	}
+
+	// 独自の解析インターフェースを実装している場合は、パースした値をそのまま渡す
+	if rv.CanAddr() && rv.Addr().Type().Implements(typeUnmarshaler) {
+		if err := rv.Addr().Interface().(Unmarshaler).UnmarshalConfig(value); err != nil {
+			return fmt.Errorf("marshal error: \"%s\" %s", key, err)
+		}
+		return nil
+	}
+
+	valueof := reflect.ValueOf(value)
+	// 型がそのまま代入可能な場合は、そのまま格納する
+	if valueof.Type().AssignableTo(rv.Type()) && rv.Kind() != reflect.Map {
+		rv.Set(valueof)
+		return nil
+	}
+	// *net.IPNet 等のポインタの値は、要素の型が代入可能な場合に格納する
+	if valueof.Kind() == reflect.Ptr && !valueof.IsNil() && valueof.Elem().Type().AssignableTo(rv.Type()) {
+		rv.Set(valueof.Elem())
+		return nil
+	}
+
+	// 時間を time.Duration 以外の数値型へ格納する場合は、従来通りミリ秒単位の値とする
+	if d, ok := value.(time.Duration); ok {
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return decode(float64(d)/float64(time.Millisecond), rv, key, o)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if d%time.Millisecond != 0 {
+				return fmt.Errorf("marshal error: \"%s\" %s can not be stored in milliseconds into %s", key, d, rv.Type())
+			}
+			return decode(int64(d/time.Millisecond), rv, key, o)
+		}
+	}
+
+	// 数値を big.Int 等の型へ、json.Number を数値型へ格納する
+	if ok, err := decodenumber(value, rv, key, o); ok {
+		return err
+	}
+
+	// 文字列の場合は、encoding.TextUnmarshaler、url.URL 型への格納を試みる
+	if s, ok := value.(string); ok {
+		if rv.CanAddr() && rv.Addr().Type().Implements(typeTextUnmarshaler) {
+			if err := rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				return fmt.Errorf("marshal error: \"%s\" %s", key, err)
+			}
+			return nil
+		}
+		if rv.Type() == typeURL {
+			u, err := url.Parse(s)
+			if err != nil {
+				return fmt.Errorf("marshal error: \"%s\" %s", key, err)
+			}
+			rv.Set(reflect.ValueOf(*u))
+			return nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return typeerror(value, rv, key)
+		}
+		rv.Set(valueof)
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			rv.SetString(v)
+		case time.Time:
+			rv.SetString(v.Format(time.RFC3339Nano))
+		// net.IP 等の値は、文字列表現を格納する
+		case fmt.Stringer:
+			rv.SetString(v.String())
+		default:
+			return typeerror(value, rv, key)
+		}
+	case reflect.Bool:
+		if valueof.Kind() != reflect.Bool {
+			return typeerror(value, rv, key)
+		}
+		rv.SetBool(valueof.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return decodeint(value, rv, key)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return decodeuint(value, rv, key)
+	case reflect.Float32, reflect.Float64:
+		switch valueof.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			rv.SetFloat(float64(valueof.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			rv.SetFloat(float64(valueof.Uint()))
+		case reflect.Float32, reflect.Float64:
+			if rv.OverflowFloat(valueof.Float()) {
+				return fmt.Errorf("marshal error: \"%s\" %v overflows %s", key, value, rv.Type())
+			}
+			rv.SetFloat(valueof.Float())
+		default:
+			return typeerror(value, rv, key)
+		}
+	case reflect.Slice:
+		if valueof.Kind() != reflect.Slice {
+			return typeerror(value, rv, key)
+		}
+		slice := reflect.MakeSlice(rv.Type(), valueof.Len(), valueof.Len())
+		for i := 0; i < valueof.Len(); i++ {
+			if err := decode(valueof.Index(i).Interface(), slice.Index(i), fmt.Sprintf("%s[%d]", key, i), o); err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+	case reflect.Array:
+		if valueof.Kind() != reflect.Slice {
+			return typeerror(value, rv, key)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i)
+			if i >= valueof.Len() {
+				elem.Set(reflect.Zero(elem.Type()))
+				continue
+			}
+			if err := decode(valueof.Index(i).Interface(), elem, fmt.Sprintf("%s[%d]", key, i), o); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		data, ok := value.(map[string]interface{})
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return typeerror(value, rv, key)
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		for name, v := range data {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err := decode(v, elem, joinkey(key, name), o); err != nil {
+				return err
+			}
+			rv.SetMapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return typeerror(value, rv, key)
+		}
+		return decodestruct(data, rv, key, o)
+	default:
+		return typeerror(value, rv, key)
+	}
+	return nil
+}
+
+// 整数型へ格納する
+func decodeint(value interface{}, rv reflect.Value, key string) error {
+	var n int64
+	valueof := reflect.ValueOf(value)
+	switch valueof.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = valueof.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if valueof.Uint() > 1<<63-1 {
+			return fmt.Errorf("marshal error: \"%s\" %v overflows %s", key, value, rv.Type())
+		}
+		n = int64(valueof.Uint())
+	case reflect.Float32, reflect.Float64:
+		// 小数部を持つ値は、整数へ格納できない
+		f := valueof.Float()
+		if f != float64(int64(f)) {
+			return typeerror(value, rv, key)
+		}
+		n = int64(f)
+	default:
+		return typeerror(value, rv, key)
+	}
+	if rv.OverflowInt(n) {
+		return fmt.Errorf("marshal error: \"%s\" %v overflows %s", key, value, rv.Type())
+	}
+	rv.SetInt(n)
+	return nil
+}
+
+// 符号なし整数型へ格納する
+func decodeuint(value interface{}, rv reflect.Value, key string) error {
+	var n uint64
+	valueof := reflect.ValueOf(value)
+	switch valueof.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if valueof.Int() < 0 {
+			return fmt.Errorf("marshal error: \"%s\" %v overflows %s", key, value, rv.Type())
+		}
+		n = uint64(valueof.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = valueof.Uint()
+	case reflect.Float32, reflect.Float64:
+		f := valueof.Float()
+		if f < 0 || f != float64(uint64(f)) {
+			return typeerror(value, rv, key)
+		}
+		n = uint64(f)
+	default:
+		return typeerror(value, rv, key)
+	}
+	if rv.OverflowUint(n) {
+		return fmt.Errorf("marshal error: \"%s\" %v overflows %s", key, value, rv.Type())
+	}
+	rv.SetUint(n)
+	return nil
+}
+
+// 数値を、big.Int, big.Float, big.Rat 型へ格納する。json.Number は、数値型のフィールドへ変換して格納する。
+// 格納対象外の場合は、false を返却する
+func decodenumber(value interface{}, rv reflect.Value, key string, o *options) (bool, error) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case int, int64, uint64:
+		s = fmt.Sprint(v)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return false, nil
+	}
+
+	switch rv.Type() {
+	case typeBigInt:
+		// 1.0 等、小数部を持たない値は整数として扱う
+		r, ok := new(big.Rat).SetString(s)
+		if !ok || !r.IsInt() {
+			return true, typeerror(value, rv, key)
+		}
+		rv.Set(reflect.ValueOf(*new(big.Int).Set(r.Num())))
+		return true, nil
+	case typeBigFloat:
+		// 記述された桁数を表現できる精度を確保する
+		prec := uint(len(s)) * 4
+		if prec < 64 {
+			prec = 64
+		}
+		f, _, err := big.ParseFloat(s, 10, prec, big.ToNearestEven)
+		if err != nil {
+			return true, typeerror(value, rv, key)
+		}
+		rv.Set(reflect.ValueOf(*f))
+		return true, nil
+	case typeBigRat:
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return true, typeerror(value, rv, key)
+		}
+		rv.Set(reflect.ValueOf(*r))
+		return true, nil
+	}
+
+	if _, ok := value.(json.Number); !ok {
+		return false, nil
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		// 1.0 等、小数部を持たない値は整数として扱う
+		r, ok := new(big.Rat).SetString(s)
+		switch {
+		case !ok || !r.IsInt():
+			return true, typeerror(value, rv, key)
+		case r.Num().IsInt64():
+			return true, decode(r.Num().Int64(), rv, key, o)
+		case r.Num().IsUint64():
+			return true, decode(r.Num().Uint64(), rv, key, o)
+		}
+		return true, fmt.Errorf("marshal error: \"%s\" %s overflows %s", key, s, rv.Type())
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return true, fmt.Errorf("marshal error: \"%s\" %s overflows %s", key, s, rv.Type())
+		}
+		return true, decode(f, rv, key, o)
+	}
+	return false, nil
+}
+
+// 構造体のフィールド情報
+type structfield struct {
+	name  string // キー名
+	index []int  // reflect.Value.FieldByIndex で使用するインデックス
+}
+
+// 構造体のフィールド一覧を取得する。埋め込み構造体のフィールドは、同じ階層のフィールドとして扱う
+func structfields(typeof reflect.Type, index []int) []structfield {
+	var fields []structfield
+	for i := 0; i < typeof.NumField(); i++ {
+		field := typeof.Field(i)
+		name := fieldname(field)
+		if name == "" {
+			continue
+		}
+		fieldtype := field.Type
+		if fieldtype.Kind() == reflect.Ptr {
+			fieldtype = fieldtype.Elem()
+		}
+		idx := append(append([]int{}, index...), i)
+		if field.Anonymous && fieldtype.Kind() == reflect.Struct {
+			if _, ok := field.Tag.Lookup("json"); !ok {
+				fields = append(fields, structfields(fieldtype, idx)...)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, structfield{name: name, index: idx})
+	}
+	return fields
+}
+
+// 構造体のフィールドを取得する。途中の埋め込みポインタが nil の場合は、領域を確保する
+func fieldbyindex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				// 非公開の埋め込み構造体ポインタには、領域を確保できない
+				if !rv.CanSet() {
+					return reflect.Value{}, false
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(idx)
+	}
+	return rv, true
+}
+
+// map のデータを、構造体へ格納する。キー名とフィールド名は、大文字、小文字を区別せずに照合する
+func decodestruct(data map[string]interface{}, rv reflect.Value, key string, o *options) error {
+	fields := structfields(rv.Type(), nil)
+	for name, value := range data {
+		var field *structfield
+		for i := range fields {
+			if fields[i].name == name {
+				field = &fields[i]
+				break
+			}
+			// CaseSensitive オプション指定時以外は、大文字、小文字を区別せずに対応付ける
+			if field == nil && !o.caseSensitive && strings.EqualFold(fields[i].name, name) {
+				field = &fields[i]
+			}
+		}
+		// 対応するフィールドが存在しない場合は、無視する
+		if field == nil {
+			continue
+		}
+		fv, ok := fieldbyindex(rv, field.index)
+		if !ok {
+			continue
+		}
+		if err := decode(value, fv, joinkey(key, name), o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ochipin/config/parser"
+)
+
+// 構造体フィールドに対応するキー名を取得する。対象外のフィールドの場合、空文字列を返却する
+func fieldname(field reflect.StructField) string {
+	// 非公開フィールドは対象外
+	if field.PkgPath != "" && !field.Anonymous {
+		return ""
+	}
+	// json タグが指定されている場合は、タグ名を優先する
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return strings.ToLower(field.Name)
+}
+
+// fn が errSkipFields を返却した場合、そのフィールドの配下は走査しない
+var errSkipFields = errors.New("skip fields")
+
+// 構造体のフィールドを走査し、フィールドごとに fn をコールする。入れ子の構造体は再帰して走査する
+func walkfields(typeof reflect.Type, keys []string, fn func(reflect.StructField, reflect.Type, []string) error) error {
+	return walk(typeof, keys, fn, map[reflect.Type]bool{})
+}
+
+// walkfields の実体。自己参照する構造体で無限に再帰しないよう、走査中の型を parents に保持する
+func walk(typeof reflect.Type, keys []string, fn func(reflect.StructField, reflect.Type, []string) error, parents map[reflect.Type]bool) error {
+	if parents[typeof] {
+		return nil
+	}
+	parents[typeof] = true
+	defer delete(parents, typeof)
+
+	for i := 0; i < typeof.NumField(); i++ {
+		field := typeof.Field(i)
+		name := fieldname(field)
+		if name == "" {
+			continue
+		}
+		// フィールドの型を取得する。ポインタの場合は、要素の型を参照する
+		fieldtype := field.Type
+		for fieldtype.Kind() == reflect.Ptr {
+			fieldtype = fieldtype.Elem()
+		}
+
+		// 埋め込み構造体の場合は、同じ階層のキーとして扱う
+		if field.Anonymous && fieldtype.Kind() == reflect.Struct {
+			if _, ok := field.Tag.Lookup("json"); !ok {
+				if err := walk(fieldtype, keys, fn, parents); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		names := append(append([]string{}, keys...), name)
+		err := fn(field, fieldtype, names)
+		if err == errSkipFields {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// 入れ子の構造体の場合は、再帰して走査する
+		if fieldtype.Kind() == reflect.Struct && fieldtype != reflect.TypeOf(time.Time{}) {
+			if err := walk(fieldtype, names, fn, parents); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ポインタの構造体フィールドは、省略可能なセクションとして扱う。
+// data に配下のキーが 1 つも存在しない場合は true を返却し、配下の default, required タグを使用しない
+func absent(data map[string]interface{}, field reflect.StructField, fieldtype reflect.Type, names []string, fold bool) bool {
+	if field.Type.Kind() != reflect.Ptr || fieldtype.Kind() != reflect.Struct || fieldtype == reflect.TypeOf(time.Time{}) {
+		return false
+	}
+	return !exists(data, names, fold)
+}
+
+// 構造体の型を取得する。構造体ではない場合、nil を返却する
+func structtype(i interface{}) reflect.Type {
+	if i == nil {
+		return nil
+	}
+	typeof := reflect.TypeOf(i)
+	for typeof.Kind() == reflect.Ptr {
+		typeof = typeof.Elem()
+	}
+	if typeof.Kind() != reflect.Struct {
+		return nil
+	}
+	return typeof
+}
+
+// 構造体に付与された default タグから、既定値のマップを生成する。data には設定ファイルの内容を渡す
+func defaults(data map[string]interface{}, i interface{}, o *options) (map[string]interface{}, error) {
+	var values = make(map[string]interface{})
+	typeof := structtype(i)
+	if typeof == nil {
+		return values, nil
+	}
+	err := walkfields(typeof, nil, func(field reflect.StructField, fieldtype reflect.Type, names []string) error {
+		if tag, ok := field.Tag.Lookup("default"); ok {
+			value, err := defaultvalue(tag, fieldtype, o)
+			if err != nil {
+				return fmt.Errorf("default value error: \"%s\" %s", strings.Join(names, "."), err)
+			}
+			setdata(values, value, names, false)
+		}
+		if absent(data, field, fieldtype, names, !o.caseSensitive) {
+			return errSkipFields
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// default タグの値を解析する
+func defaultvalue(tag string, typeof reflect.Type, o *options) (interface{}, error) {
+	// 文字列型のフィールドの場合、引用符や環境変数で始まらない値は、そのまま文字列として扱う
+	if typeof.Kind() == reflect.String {
+		if tag == "" || (tag[0] != '"' && tag[0] != '\'' && tag[0] != '$' && tag[0] != '`') {
+			return tag, nil
+		}
+	}
+	return parser.ParseValue(tag, o.parser...)
+}
@@ -1 +1,3 @@
 module github.com/ochipin/config
+
+go 1.18
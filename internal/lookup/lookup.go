@@ -0,0 +1,22 @@
+// Package lookup は、parser, config パッケージで共有するキー名の検索処理を提供する
+package lookup
+
+import "strings"
+
+// Key は、data 内の既存のキー名を取得する。fold が true の場合は、大文字、小文字を区別せずに一致するキー名を返却する。
+// 一致するキー名が複数ある場合は、辞書順で最初のキー名、一致するキー名がない場合は key をそのまま返却する
+func Key(data map[string]interface{}, key string, fold bool) string {
+	if _, ok := data[key]; ok || !fold {
+		return key
+	}
+	var found string
+	for k := range data {
+		if strings.EqualFold(k, key) && (found == "" || k < found) {
+			found = k
+		}
+	}
+	if found == "" {
+		return key
+	}
+	return found
+}
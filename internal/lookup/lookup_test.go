@@ -0,0 +1,16 @@
+package lookup
+
+import "testing"
+
+// 既存のキー名の表記を取得する
+func TestKey(t *testing.T) {
+	var data = map[string]interface{}{"Port": 1, "PORT": 2, "host": 3}
+	for key, expect := range map[string]string{"port": "PORT", "Port": "Port", "HOST": "host", "name": "name"} {
+		if v := Key(data, key, true); v != expect {
+			t.Errorf("%s: %s != %s", key, v, expect)
+		}
+	}
+	if v := Key(data, "port", false); v != "port" {
+		t.Error(v)
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ochipin/config/parser"
+)
+
+// Option : Parse, Unmarshal 関数の動作を変更するオプション
+type Option func(*options)
+
+// オプションの設定値
+type options struct {
+	required      []string        // 必須のキー名
+	parser        []parser.Option // パーサのオプション
+	caseSensitive bool            // キー名の大文字、小文字を区別する場合 true
+	filename      string          // エラーメッセージに付与するファイル名
+	interval      time.Duration   // Watcher のポーリングの間隔
+}
+
+// オプションを適用した設定値を生成する
+func newOptions(opts []Option) *options {
+	var o = &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// 設定ファイルの解析エラーに、ファイル名を付与する
+func (o *options) error(err error) error {
+	if o.filename == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %s", o.filename, err)
+}
+
+// Require : 設定ファイルに必ず存在しなければならないキー名を指定する。ex) Require("db.host", "db.port")
+func Require(keys ...string) Option {
+	return func(o *options) {
+		o.required = append(o.required, keys...)
+	}
+}
+
+// ParserOptions : 設定ファイル、及び default タグの解析に使用するパーサのオプションを指定する。
+// ex) ParserOptions(parser.Location(time.Local))
+func ParserOptions(opts ...parser.Option) Option {
+	return func(o *options) {
+		o.parser = append(o.parser, opts...)
+	}
+}
+
+// PreserveCase : キー名を小文字へ変換せず、記述した通りに扱う。map 型のフィールドには、記述した通りのキー名で格納する。
+// キー名の重複、構造体のフィールド名との対応付けは、大文字、小文字を区別せずに判定する
+func PreserveCase() Option {
+	return func(o *options) {
+		o.parser = append(o.parser, parser.PreserveCase())
+		o.caseSensitive = false
+	}
+}
+
+// CaseSensitive : キー名を小文字へ変換せず、大文字、小文字を区別して扱う。
+// 構造体のフィールドには、json タグの名前、または小文字のフィールド名と完全に一致するキー名のみ格納する
+func CaseSensitive() Option {
+	return func(o *options) {
+		o.parser = append(o.parser, parser.CaseSensitive())
+		o.caseSensitive = true
+	}
+}
+
+// Filename : エラーメッセージに付与する、設定ファイルの論理的な名前を指定する。ex) Filename("<stdin>")
+func Filename(name string) Option {
+	return func(o *options) {
+		o.filename = name
+	}
+}
+
+// PollInterval : Watcher で、inotify を使用せずに、指定した間隔で設定ファイルの変更をポーリングする。
+// inotify が通知されない NFS 等のファイルシステムで使用する。ex) PollInterval(5 * time.Second)
+func PollInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
@@ -3,112 +3,230 @@ package parser
 import (
 	"fmt"
 	"reflect"
-	"time"
 )
 
 // Array 構造体は、配列を解析する
 type Array struct {
-	Value             // Value 構造体をミックスイン
-	keep  int         // コメント時のキープ処理
-	node  Node        // インナー配列を処理
-	data  interface{} // 格納するデータ型
-	next  bool        // カンマの位置や、連続したカンマの制御に使用
-	kind  string      // 配列内で、型が違うデータがあった場合にエラーにするために使用する
-	comp  bool        // 配列内の値解析完了フラグ
+	lexer               // lexer 構造体をミックスイン
+	node  Node          // 配列内の値を処理
+	data  []interface{} // 格納するデータ
+	typ   reflect.Type  // 配列内で、型が違うデータがあった場合にエラーにするために使用する
+	next  bool          // カンマの位置や、連続したカンマの制御に使用
+	comp  bool          // 配列内の値解析完了フラグ
+	empty int           // 要素に持つ emptyArray の、最大の入れ子の深さ
+	neg   bool          // 負の整数を含む場合 true
+	root  *Array        // 最も外側の配列
+	stack []*Array      // 最も外側の配列から、解析中のインナー配列までの一覧
+}
+
+// emptyArray は、空の配列のみを要素に持つインナー配列 ex) [], [[], [[]]]。
+// 外側の配列で他の要素の型が決まった時点で、その型のスライスとする
+type emptyArray []emptyArray
+
+// 配列の入れ子の深さを返却する。[] は 1、[[]] は 2 とする
+func (e emptyArray) depth() int {
+	depth := 1
+	for _, inner := range e {
+		if n := inner.depth() + 1; n > depth {
+			depth = n
+		}
+	}
+	return depth
+}
+
+// typ 型のスライスを生成する
+func (e emptyArray) value(typ reflect.Type) reflect.Value {
+	values := reflect.MakeSlice(typ, len(e), len(e))
+	for i, inner := range e {
+		values.Index(i).Set(inner.value(typ.Elem()))
+	}
+	return values
+}
+
+// 他に型を決める要素がない場合は、[]interface{} とする
+func (e emptyArray) interfaces() []interface{} {
+	values := make([]interface{}, len(e))
+	for i, inner := range e {
+		values[i] = inner.interfaces()
+	}
+	return values
+}
+
+// 型 typ が表す配列の入れ子の深さを返却する。net.IP 等のバイト列は、配列として扱わない
+func sliceDepth(typ reflect.Type) int {
+	var depth int
+	for typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 {
+		depth++
+		typ = typ.Elem()
+	}
+	return depth
 }
 
 // NewArray 関数は、配列解析用ノードを生成する
 func NewArray(p Node) Node {
-	return &Array{
-		Value: Value{
-			text: p.Text(),
-			stat: ParserBeginArray,
-			cnt:  p.Getidx(),
-			pos:  p.Pos(),
-			end:  p.End(),
-			key:  p.Keyname(),
-		},
-		next: true,
-		data: nil,
-	}
+	array := &Array{lexer: newLexer(p, ParserBeginArray), next: true}
+	array.root = array
+	array.stack = []*Array{array}
+	return array
 }
 
 // データ追加関数
-func (array *Array) adddata(data interface{}, inner bool) error {
-	// 型情報と値情報を取得する
-	valueof := reflect.ValueOf(data)
-	kind := valueof.Type().String()
-	if array.kind == "" {
-		array.kind = kind
-	}
-
-	// 型が違う者同士の配列の場合、エラーとする
-	if array.kind != kind {
-		return fmt.Errorf("\"%s\" array of different types are confused", array.key)
-	}
-
-	// int, float32, string, bool, time.Time の方の場合
-	switch data.(type) {
-	case int:
-		if array.data == nil {
-			array.data = []int{}
-		}
-		array.data = append(array.data.([]int), data.(int))
-		return nil
-	case float32:
-		if array.data == nil {
-			array.data = []float32{}
-		}
-		array.data = append(array.data.([]float32), data.(float32))
-		return nil
-	case string:
-		if array.data == nil {
-			array.data = []string{}
-		}
-		array.data = append(array.data.([]string), data.(string))
-		return nil
-	case bool:
-		if array.data == nil {
-			array.data = []bool{}
-		}
-		array.data = append(array.data.([]bool), data.(bool))
-		return nil
-	case time.Time:
-		if array.data == nil {
-			array.data = []time.Time{}
-		}
-		array.data = append(array.data.([]time.Time), data.(time.Time))
-		return nil
-	}
-
-	// array.data がまだ未登録の場合
-	if array.data == nil {
-		// ex) []int をベースに、[][]int 配列を作成する
-		v := reflect.MakeSlice(reflect.SliceOf(valueof.Type()), 0, 0)
-		// ex) [][]int に、 []int{0...} を格納する []int[0] = []int を格納するイメージ
-		valueof = reflect.Append(v, valueof)
-		array.data = valueof.Interface()
-		return nil
-	}
-	// array.data が既にある場合、動的配列を生成する
-	v := reflect.MakeSlice(reflect.ValueOf(array.data).Type(), 0, 0)
-	// 配列の結合を行う。 []int[0] = array.data[0], []int[1] = array.data[1] を格納するイメージ
-	v = reflect.AppendSlice(v, reflect.ValueOf(array.data))
-	// 配列の追加を行う。 []int[2] = valueof を格納するイメージ
-	valueof = reflect.Append(v, valueof)
-
-	array.data = valueof.Interface()
+func (array *Array) adddata(data interface{}) error {
+	if empty, ok := data.(emptyArray); ok {
+		// 空の配列は、同じ深さ以上の配列の要素とのみ混在できる
+		depth := empty.depth()
+		if array.typ != nil && sliceDepth(array.typ) < depth {
+			return fmt.Errorf("\"%s\" array of different types are confused", array.key)
+		}
+		if depth > array.empty {
+			array.empty = depth
+		}
+	} else {
+		if data == nil {
+			return fmt.Errorf("\"%s\" array value is invalid", array.key)
+		}
+		// 型が違う者同士の配列の場合、エラーとする
+		typ := reflect.TypeOf(data)
+		if array.typ == nil {
+			if sliceDepth(typ) < array.empty {
+				return fmt.Errorf("\"%s\" array of different types are confused", array.key)
+			}
+			array.typ = typ
+		}
+		if array.typ != typ {
+			// 整数は、値の範囲により型が異なるため、共通の型へ揃える
+			widened, ok := widenInt(array.typ, typ)
+			if !ok {
+				return fmt.Errorf("\"%s\" array of different types are confused", array.key)
+			}
+			array.typ = widened
+		}
+		if n, ok := data.(int); ok && n < 0 {
+			array.neg = true
+		} else if n, ok := data.(int64); ok && n < 0 {
+			array.neg = true
+		}
+		if array.neg && array.typ == typeUint64 {
+			return fmt.Errorf("\"%s\" array of integers out of range", array.key)
+		}
+	}
+	if err := array.limitArray(len(array.data) + 1); err != nil {
+		return err
+	}
+	array.data = append(array.data, data)
 	return nil
 }
 
-// Analyze 関数は、配列を解析する
-func (array *Array) Analyze(b byte) (i interface{}, err error) {
-	// コメント処理の場合
-	if array.stat == ParserComment {
-		if b != '\n' {
-			return
+// 配列の要素の型
+var (
+	typeInt    = reflect.TypeOf(0)
+	typeInt64  = reflect.TypeOf(int64(0))
+	typeUint64 = reflect.TypeOf(uint64(0))
+	typeString = reflect.TypeOf("")
+)
+
+// 整数の型 t1, t2 を、両方の値を格納できる型へ揃える。int < int64 < uint64 の順に広い型とする。
+// 整数以外の型の場合は false を返却する
+func widenInt(t1, t2 reflect.Type) (reflect.Type, bool) {
+	var rank = func(t reflect.Type) int {
+		switch t {
+		case typeInt:
+			return 1
+		case typeInt64:
+			return 2
+		case typeUint64:
+			return 3
+		}
+		return 0
+	}
+	if rank(t1) == 0 || rank(t2) == 0 {
+		return t1, false
+	}
+	if rank(t1) < rank(t2) {
+		return t2, true
+	}
+	return t1, true
+}
+
+// 格納したデータから、要素の型のスライスを生成する。ex) []int, [][]string
+func (array *Array) values() interface{} {
+	if array.typ == nil {
+		// 空の配列のみを要素に持つ場合は、外側の配列で他の要素の型に合わせる
+		empty := make(emptyArray, len(array.data))
+		for i, v := range array.data {
+			empty[i] = v.(emptyArray)
+		}
+		if array.root != array {
+			return empty
+		}
+		if len(empty) == 0 {
+			return nil
+		}
+		return empty.interfaces()
+	}
+	switch array.typ {
+	case typeInt:
+		values := make([]int, len(array.data))
+		for i, v := range array.data {
+			values[i] = v.(int)
 		}
-		array.stat = array.keep
+		return values
+	case typeString:
+		values := make([]string, len(array.data))
+		for i, v := range array.data {
+			values[i] = v.(string)
+		}
+		return values
+	}
+	values := reflect.MakeSlice(reflect.SliceOf(array.typ), len(array.data), len(array.data))
+	for i, v := range array.data {
+		if empty, ok := v.(emptyArray); ok {
+			values.Index(i).Set(empty.value(array.typ))
+			continue
+		}
+		values.Index(i).Set(reflect.ValueOf(v).Convert(array.typ))
+	}
+	return values.Interface()
+}
+
+// 配列内の値の解析完了時にコールされ、配列に要素を追加する
+func (array *Array) complete(data interface{}) error {
+	if err := array.adddata(data); err != nil {
+		return err
+	}
+	array.node = nil
+	array.stat = ParserBeginArray
+	array.next = false // 次の要素を許可
+	array.comp = true  // 値解析完了
+	return nil
+}
+
+// 解析中のインナー配列を返却する。インナー配列がない場合は、自身を返却する
+func (array *Array) inner() *Array {
+	return array.root.stack[len(array.root.stack)-1]
+}
+
+// Analyze 関数は、配列を解析する。インナー配列は、外側の配列を経由せず、解析中のインナー配列で直接解析する
+func (array *Array) Analyze(b byte) (interface{}, error) {
+	inner := array.inner()
+	inner.Cnt(array.cnt)
+	data, err := inner.analyze(b)
+	if err != nil {
+		return nil, err
+	}
+	// インナー配列の解析が完了した場合、外側の配列に要素を追加する
+	if inner != array && inner.stat == ParserNone {
+		array.stack = array.stack[:len(array.stack)-1]
+		return nil, array.inner().complete(data)
+	}
+	return data, nil
+}
+
+// 配列内の値を解析する
+func (array *Array) analyze(b byte) (i interface{}, err error) {
+	// コメント処理の場合
+	if array.comment(b) {
+		return
 	}
 
 	// 配列内を解析する node を array が所持していた場合
@@ -120,32 +238,20 @@ func (array *Array) Analyze(b byte) (i interface{}, err error) {
 		if err != nil {
 			return nil, err
 		}
-		// インナー配列か否かを判定するフラグを取得する
-		_, inner := array.node.(*Array)
-		// 値の取得が完了した場合、配列に要素を追加する
-		if array.node.Stat() == ParserNone {
-			err := array.adddata(data, inner)
-			if err != nil {
-				return nil, err
-			}
-			data = array.data
-			array.node = nil
-			array.stat = ParserBeginArray
-			array.next = false // 次の要素を許可
-			array.comp = true  // 値解析完了
-		} else {
+		// 値の取得が完了していない場合は、関数を抜ける
+		if array.node.Stat() != ParserNone {
 			return nil, nil
 		}
-		// インナー配列の場合、関数を抜ける
-		if inner {
-			return data, err
+		// 値の取得が完了した場合、配列に要素を追加する
+		if err := array.complete(data); err != nil {
+			return nil, err
 		}
 	}
 
 	// 値解析完了済みだが、カンマがなく、次の要素を指していた場合、エラーとする
 	if array.comp {
 		switch b {
-		case '+', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 't', 'f', '$', '"', 39, '#':
+		case '+', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 't', 'f', '$', '"', 39, '`', '#':
 			return nil, fmt.Errorf("\"%s\" separator is invalid", array.key)
 		}
 	}
@@ -160,40 +266,39 @@ func (array *Array) Analyze(b byte) (i interface{}, err error) {
 
 // 配列開始時に、コールされる
 func (array *Array) parseBeginArray(b byte) (interface{}, error) {
+	// 値の先頭の文字から、値解析用ノードを生成する
+	switch b {
+	case ' ', '\n', '\t', '#', ',', ']':
+	default:
+		array.pos = array.cnt
+		array.end = array.cnt + 1
+		if node := newNode(array, b); node != nil {
+			// カンマがなく、次の要素を指していた場合、エラーとする
+			if array.comp {
+				return nil, fmt.Errorf("\"%s\" separator is invalid", array.key)
+			}
+			array.node = node
+			return nil, nil
+		}
+	}
 	switch b {
-	// インナー配列
+	// インナー配列は、最も外側の配列で管理する
 	case '[':
-		array.node = NewArray(array)
+		if err := array.limitDepth(len(array.root.stack) + 1); err != nil {
+			return nil, err
+		}
+		inner := NewArray(array).(*Array)
+		inner.root = array.root
+		array.root.stack = append(array.root.stack, inner)
 	// 配列終了
 	case ']':
 		array.stat = ParserNone
-		return array.data, nil
-	// 整数を解析する
-	case '+', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		array.pos = array.cnt
-		array.end = array.cnt + 1
-		array.node = NewNumber(array)
-	// 真偽値を解析
-	case 't', 'f':
-		array.pos = array.cnt
-		array.end = array.cnt + 1
-		array.node = NewBoolean(array)
-	// 文字列を解析する
-	case '"', 39:
-		array.pos = array.cnt
-		array.end = array.cnt + 1
-		array.node = NewString(array)
-	// 環境変数を解析する
-	case '$':
-		array.pos = array.cnt
-		array.end = array.cnt + 1
-		array.node = NewEnviron(array)
+		return array.values(), nil
 	// 空白はスルーする
 	case ' ', '\n', '\t':
 	// コメント行としてみなす
 	case '#':
-		array.keep = array.stat
-		array.stat = ParserComment
+		array.skipLine()
 	// , の場合は、セパレータとしてみなす
 	case ',':
 		// 連続したカンマは不正記述とする
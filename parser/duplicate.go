@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Warning は、LastWins, FirstWins オプション指定時に、重複して定義されたキー名の情報を保持する
+type Warning struct {
+	Mode     string // モード名
+	Key      string // 重複して定義されたキー名
+	Line     int    // 重複して定義された行番号
+	Previous int    // 先に定義されていた行番号
+	Ignored  bool   // 重複した定義を無視した場合 true。上書きした場合 false
+}
+
+// String は、警告内容を文字列で返却する
+func (w Warning) String() string {
+	if w.Ignored {
+		return fmt.Sprintf("warning:%d: \"%s\" is ignored. already defined at line %d", w.Line, w.Key, w.Previous)
+	}
+	return fmt.Sprintf("warning:%d: \"%s\" overrides the definition at line %d", w.Line, w.Key, w.Previous)
+}
+
+// Warnings は、重複して定義されたキー名の一覧を、出現順に返却する
+func (p *Parser) Warnings() []Warning {
+	return p.warns
+}
+
+// 行番号、キー名の順序を管理するための、モード名を含めたキー名を生成する
+func (p *Parser) path(mode string, names []string) string {
+	var key = mode + "\x00" + joinKey(names)
+	if p.option().keyCase == keyPreserve {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// names の各階層までの、行番号、キー名の順序を管理するためのキー名を生成する。
+// paths[i] は、p.path(mode, names[:i]) と同じ値になる
+func (p *Parser) paths(mode string, names []string) []string {
+	var lower = p.option().keyCase == keyPreserve
+	var paths = make([]string, len(names)+1)
+	paths[0] = mode + "\x00"
+	if lower {
+		paths[0] = strings.ToLower(paths[0])
+	}
+	for i, name := range names {
+		name = quoteKey(name)
+		if lower {
+			name = strings.ToLower(name)
+		}
+		if i == 0 {
+			paths[i+1] = paths[i] + name
+		} else {
+			paths[i+1] = paths[i] + "." + name
+		}
+	}
+	return paths
+}
+
+// 値を格納し、キー名を定義した行番号を記録する。重複した場合は、オプションの指定に従う
+func (p *Parser) set(names []string, value interface{}) error {
+	var o = p.option()
+	var line = p.line + 1
+	var dup func([]string) (bool, error)
+	if o.duplicate != duplicateError {
+		dup = func(path []string) (bool, error) {
+			var key = p.path(p.mode, path)
+			p.warns = append(p.warns, Warning{
+				Mode:     p.mode,
+				Key:      p.key,
+				Line:     line,
+				Previous: p.lines[key],
+				Ignored:  o.duplicate == duplicateFirstWins,
+			})
+			if o.duplicate == duplicateFirstWins {
+				return false, nil
+			}
+			// 上書きされたキー、及びキー配下の行番号は、破棄する
+			for k := range p.lines {
+				if k == key || strings.HasPrefix(k, key+".") {
+					delete(p.lines, k)
+				}
+			}
+			return true, nil
+		}
+	}
+	var n = len(p.warns)
+	if err := setKeys(names, value, p.data, p.mode, o.keyCase == keyPreserve, dup); err != nil {
+		return err
+	}
+	// 先に定義した値を使用した場合は、行番号を更新しない
+	if len(p.warns) > n && p.warns[n].Ignored {
+		return nil
+	}
+	if p.lines == nil {
+		p.lines = make(map[string]int)
+	}
+	var paths = p.paths(p.mode, names)
+	for i := 1; i <= len(names); i++ {
+		if key := paths[i]; i == len(names) || p.lines[key] == 0 {
+			p.lines[key] = line
+		}
+	}
+	p.ordered(names, paths)
+	return nil
+}
@@ -0,0 +1,27 @@
+package parser
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// 設定ファイル内の位置情報を持つエラー
+type positionError struct {
+	offset int   // 設定ファイル先頭からのバイト位置
+	err    error // エラー内容
+}
+
+func (e *positionError) Error() string {
+	return e.err.Error()
+}
+
+// 設定ファイル先頭からのバイト位置を、行番号、桁番号 (文字数) へ変換する
+func position(text []byte, offset int) (line, col int) {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	start := bytes.LastIndexByte(text[:offset], '\n') + 1
+	line = bytes.Count(text[:offset], []byte("\n")) + 1
+	col = utf8.RuneCount(text[start:offset]) + 1
+	return line, col
+}
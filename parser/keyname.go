@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// キー名を "." 区切りで分割する。"..." または '...' で囲まれた部分は、"." や空白を含む1つのキー名として扱う。
+// 引用符で囲まれていないキー名は、PreserveCase, CaseSensitive オプション指定時以外は小文字へ変換する
+func splitKey(s string, o *options) ([]string, bool) {
+	var keys []string
+	for {
+		s = trimSpace(s)
+		if s == "" {
+			return nil, false
+		}
+		var key string
+		switch s[0] {
+		// "..." の場合は、エスケープシーケンスを展開する
+		case '"':
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, false
+			}
+			k, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil, false
+			}
+			key, s = k, s[end+1:]
+		// '...' の場合は、そのままキー名とする
+		case '\'':
+			end := strings.IndexByte(s[1:], '\'')
+			if end == -1 {
+				return nil, false
+			}
+			key, s = s[1:end+1], s[end+2:]
+		default:
+			end := strings.IndexByte(s, '.')
+			if end == -1 {
+				end = len(s)
+			}
+			key, s = trimSpace(s[:end]), s[end:]
+			if !isBareKey(key, o.unicodeKeys) {
+				return nil, false
+			}
+			if o.keyCase == keyLower {
+				key = strings.ToLower(key)
+			}
+		}
+		if key == "" {
+			return nil, false
+		}
+		keys = append(keys, key)
+
+		// 次のキー名は、"." で区切られていなければならない
+		s = trimSpace(s)
+		if s == "" {
+			return keys, true
+		}
+		if s[0] != '.' {
+			return nil, false
+		}
+		s = s[1:]
+	}
+}
+
+// 引用符で囲まれていないキー名として正しいか判定する。英数字とアンダーバーのみ指定でき、
+// 先頭は数字、アンダーバー以外、最後尾はアンダーバー以外でなければならない。
+// unicodeKeys が true の場合は、Unicode の文字、数字も許可する
+func isBareKey(key string, unicodeKeys bool) bool {
+	if key == "" || key[0] == '_' || key[len(key)-1] == '_' {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r == '_':
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				return false
+			}
+		case unicodeKeys && (unicode.IsLetter(r) || unicode.IsMark(r) && i != 0):
+		case unicodeKeys && unicode.IsDigit(r) && i != 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// 分割したキー名を、"." 区切りのキー名へ戻す。引用符が必要なキー名は、"..." で囲む
+func joinKey(keys []string) string {
+	var names = make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = quoteKey(key)
+	}
+	return strings.Join(names, ".")
+}
+
+// 引用符が必要なキー名の場合は、"..." で囲む
+func quoteKey(key string) string {
+	if isBareKey(key, true) {
+		return key
+	}
+	return strconv.Quote(key)
+}
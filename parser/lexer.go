@@ -0,0 +1,130 @@
+package parser
+
+import "bytes"
+
+// token 構造体は、字句解析で取り出した値。pos, end は、設定ファイル内の値の範囲
+type token struct {
+	text string // 行継続を除去した値。値の途中の空白は、そのまま保持する
+	pos  int    // 値の開始位置
+	end  int    // 値の終了位置
+}
+
+// lexer 構造体は、数字、真偽値、文字列、環境変数等の値の解析で共通する、空白、コメント、値の終わりを判定する。
+// 各ノードは lexer をミックスインし、取り出した token を値へ変換する
+type lexer struct {
+	Value        // Value 構造体をミックスイン
+	keep    int  // コメント終了後に戻す解析状態
+	array   bool // 配列内の値の場合 true。, ] を値の終わりとして扱う
+	bracket bool // [::1]:8080 形式の [ ] を、値の一部として扱う場合 true
+}
+
+// 親ノード p の参照位置を引き継いだ lexer を生成する
+func newLexer(p Node, stat int) lexer {
+	return lexer{
+		Value: Value{
+			src:  sourceOf(p),
+			stat: stat,
+			cnt:  p.Getidx(),
+			pos:  p.Pos(),
+			end:  p.End(),
+			key:  p.Keyname(),
+			opts: optionsOf(p),
+		},
+		array: inArray(p),
+	}
+}
+
+// scan 関数は、1文字を読み込み、値の終わりに達した場合は取り出した token と true を返却する。
+// 空白は値に含めず、# から改行まではコメントとして読み飛ばす
+func (lx *lexer) scan(b byte) (token, bool) {
+	if lx.comment(b) {
+		return token{}, false
+	}
+	switch {
+	case lx.terminator(b):
+		lx.stat = ParserNone
+		return token{text: lx.Param(), pos: lx.pos, end: lx.end}, true
+	case b == '#':
+		lx.skipLine()
+	case b != ' ':
+		lx.end = lx.cnt + 1
+	}
+	return token{}, false
+}
+
+// comment 関数は、コメントを読み飛ばしている場合 true を返却する。改行の場合は、コメント前の解析状態へ戻す
+func (lx *lexer) comment(b byte) bool {
+	if lx.stat != ParserComment {
+		return false
+	}
+	if b != '\n' {
+		return true
+	}
+	lx.stat = lx.keep
+	return false
+}
+
+// skipLine 関数は、改行までをコメントとして読み飛ばす
+func (lx *lexer) skipLine() {
+	lx.keep = lx.stat
+	lx.stat = ParserComment
+}
+
+// terminator 関数は、値の終わりを表す文字か判定する。配列内の値の場合は、, ] も値の終わりとする
+func (lx *lexer) terminator(b byte) bool {
+	switch b {
+	case '\n':
+		return true
+	case ',':
+		return lx.array
+	case ']':
+		if !lx.array {
+			return false
+		}
+		// [::1]:8080 形式の場合、[ に対応する ] は値の一部とする
+		if lx.bracket {
+			text := lx.Text()
+			return lx.end <= lx.pos || text[lx.pos] != '[' || bytes.IndexByte(text[lx.pos:lx.end], ']') != -1
+		}
+		return true
+	}
+	return false
+}
+
+// 値の先頭の文字 b から、値解析用ノードを生成する。値として解析できない場合は nil を返却する。
+// p.Getidx(), p.Pos() は、値の先頭を参照していること
+func newNode(p Node, b byte) Node {
+	// 登録済みのノードで解析できる値の場合
+	if node := newRegisteredNode(p); node != nil {
+		return node
+	}
+	// IPアドレス、CIDR、ホスト名:ポート番号の場合
+	if isNetwork(p.Text(), p.Getidx()) {
+		return NewNetwork(p)
+	}
+	switch b {
+	// 小数点、日付、10/8/16進数のいずれかの場合
+	case '0', '+', '-', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return NewNumber(p)
+	// inf, nan
+	case 'i', 'n':
+		if isSpecialFloat(p.Text(), p.Getidx()) {
+			return NewNumber(p)
+		}
+	// 真偽値
+	case 't', 'f':
+		return NewBoolean(p)
+	// 文字列
+	case '"', 39, '`':
+		return NewString(p)
+	// |""", >""" 形式の複数行文字列
+	case '|', '>':
+		if isBlockString(p.Text(), p.Getidx()) {
+			return NewString(p)
+		}
+	// 環境変数
+	case '$':
+		return NewEnviron(p)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package parser
+
+import "fmt"
+
+// 設定ファイルのサイズ size が、MaxInputSize の上限を超えていないかチェックする
+func (o *options) limitSize(size int) error {
+	if o.maxInput > 0 && size > o.maxInput {
+		return fmt.Errorf("syntax error: input size exceeds the limit of %d bytes", o.maxInput)
+	}
+	return nil
+}
+
+// キー名の階層、配列の入れ子の深さが、MaxDepth の上限を超えていないかチェックする
+func (v *Value) limitDepth(depth int) error {
+	if max := v.option().maxDepth; max > 0 && depth > max {
+		return fmt.Errorf("\"%s\" nesting depth exceeds the limit of %d", v.key, max)
+	}
+	return nil
+}
+
+// 配列の要素数が、MaxArrayLength の上限を超えていないかチェックする
+func (v *Value) limitArray(length int) error {
+	if max := v.option().maxArray; max > 0 && length > max {
+		return fmt.Errorf("\"%s\" array length exceeds the limit of %d", v.key, max)
+	}
+	return nil
+}
+
+// 文字列の長さが、MaxStringLength の上限を超えていないかチェックする
+func (v *Value) limitString(length int) error {
+	if max := v.option().maxString; max > 0 && length > max {
+		return fmt.Errorf("\"%s\" string length exceeds the limit of %d bytes", v.key, max)
+	}
+	return nil
+}
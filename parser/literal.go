@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// NodeFunc は、値解析用ノードを生成する関数。p には、値の先頭を参照している親ノードが渡される
+type NodeFunc func(p Node) Node
+
+// LiteralFunc は、タグ付き文字列 ex) ip"10.0.0.1" の文字列部分を、値へ変換する関数
+type LiteralFunc func(s string) (interface{}, error)
+
+// 登録済みのノード、タグ付き文字列
+var (
+	registry = struct {
+		sync.RWMutex
+		prefixes []string               // 登録済みの接頭辞。長い順に並べる
+		nodes    map[string]NodeFunc    // 接頭辞と、ノード生成関数の対応表
+		literals map[string]LiteralFunc // タグ名と、変換関数の対応表
+	}{
+		nodes:    make(map[string]NodeFunc),
+		literals: make(map[string]LiteralFunc),
+	}
+)
+
+// RegisterNode は、指定した接頭辞で始まる値を解析するノードを登録する。
+// 登録したノードは、組み込みの値よりも優先して使用される
+func RegisterNode(prefix string, fn NodeFunc) {
+	registry.Lock()
+	defer registry.Unlock()
+	if prefix == "" || fn == nil {
+		panic("parser: RegisterNode prefix or function is empty")
+	}
+	if _, ok := registry.nodes[prefix]; ok {
+		panic("parser: RegisterNode called twice for prefix " + prefix)
+	}
+	registry.nodes[prefix] = fn
+	registry.prefixes = append(registry.prefixes, prefix)
+	sort.SliceStable(registry.prefixes, func(i, j int) bool {
+		return len(registry.prefixes[i]) > len(registry.prefixes[j])
+	})
+}
+
+// RegisterLiteral は、name"..." 形式のタグ付き文字列を、値へ変換する関数を登録する。
+// タグ名に使用できる文字は、半角英小文字、数字、アンダーバーで、先頭は英小文字とする
+func RegisterLiteral(name string, fn LiteralFunc) {
+	registry.Lock()
+	defer registry.Unlock()
+	if !isTagname(name) || fn == nil {
+		panic("parser: RegisterLiteral invalid name " + name)
+	}
+	if _, ok := registry.literals[name]; ok {
+		panic("parser: RegisterLiteral called twice for name " + name)
+	}
+	registry.literals[name] = fn
+}
+
+// タグ名として正しいかチェックする
+func isTagname(name string) bool {
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// 登録済みのノードから、値の先頭に一致するノードを生成する。一致するノードがない場合、nil を返却する
+func newRegisteredNode(p Node) Node {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	text := p.Text()[p.Getidx():]
+	// タグ付き文字列 ex) ip"10.0.0.1" の場合
+	if len(registry.literals) > 0 {
+		i := 0
+		for i < len(text) && ((text[i] >= 'a' && text[i] <= 'z') || (text[i] >= '0' && text[i] <= '9') || text[i] == '_') {
+			i++
+		}
+		if i > 0 && i < len(text) && (text[i] == '"' || text[i] == '\'') {
+			if fn, ok := registry.literals[string(text[:i])]; ok {
+				return newLiteral(p, string(text[:i]), fn)
+			}
+		}
+	}
+	// 接頭辞で登録されたノードの場合
+	for _, prefix := range registry.prefixes {
+		if bytes.HasPrefix(text, []byte(prefix)) {
+			return registry.nodes[prefix](p)
+		}
+	}
+	return nil
+}
+
+// Literal 構造体は、タグ付き文字列 ex) ip"10.0.0.1" を解析する
+type Literal struct {
+	Value
+	name  string      // タグ名
+	fn    LiteralFunc // 文字列を値へ変換する関数
+	node  Node        // 文字列解析用ノード
+	array bool        // 配列内の値として使用される場合 true
+}
+
+// タグ付き文字列解析用ノードを生成する
+func newLiteral(p Node, name string, fn LiteralFunc) Node {
+	return &Literal{
+		Value: Value{
+			src:  sourceOf(p),
+			cnt:  p.Getidx(),
+			pos:  p.Pos(),
+			end:  p.End(),
+			key:  p.Keyname(),
+			opts: optionsOf(p),
+		},
+		name:  name,
+		fn:    fn,
+		array: inArray(p),
+	}
+}
+
+// Analyze 関数は、タグ付き文字列を解析する
+func (literal *Literal) Analyze(b byte) (interface{}, error) {
+	// タグ名を読み飛ばし、引用符の位置から文字列の解析を開始する
+	if literal.node == nil {
+		if literal.cnt < literal.pos+len(literal.name) {
+			return nil, nil
+		}
+		literal.pos = literal.cnt
+		literal.end = literal.cnt + 1
+		literal.node = NewString(literal)
+		return nil, nil
+	}
+
+	literal.node.Cnt(literal.cnt)
+	data, err := literal.node.Analyze(b)
+	if err != nil || literal.node.Stat() != ParserNone {
+		return nil, err
+	}
+	// 文字列の解析が完了した場合、値へ変換する
+	literal.stat = ParserNone
+	value, err := literal.fn(data.(string))
+	if err != nil {
+		return nil, fmt.Errorf("\"%s\" %s literal invalid value \"%s\": %s", literal.key, literal.name, data, err)
+	}
+	return value, nil
+}
+
+// 親ノードが、配列かチェックする
+func inArray(p Node) bool {
+	switch node := p.(type) {
+	case *Array:
+		return true
+	case *Literal:
+		return node.array
+	}
+	return false
+}
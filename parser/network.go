@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Network 構造体は、IPアドレス、CIDR、ホスト名:ポート番号 を解析する
+type Network struct {
+	lexer
+}
+
+// NewNetwork 関数は、ネットワークアドレス解析用ノードを生成する
+func NewNetwork(p Node) Node {
+	network := &Network{lexer: newLexer(p, ParserValue)}
+	network.bracket = true
+	return network
+}
+
+// Analyze 関数は、ネットワークアドレスを解析する
+func (network *Network) Analyze(b byte) (interface{}, error) {
+	tok, ok := network.scan(b)
+	if !ok {
+		return nil, nil
+	}
+	// 取得したパラメータが正しいか検証
+	param := trimSpace(tok.text)
+	if hasSpace(param) {
+		return nil, fmt.Errorf("\"%s = %s\" network address invalid value", network.key, param)
+	}
+	value, ok := parseNetwork(param)
+	if !ok && invalidPort(param) {
+		return nil, fmt.Errorf("\"%s = %s\" port number invalid value", network.key, param)
+	}
+	if !ok {
+		return nil, fmt.Errorf("\"%s = %s\" network address invalid value", network.key, param)
+	}
+	return value, nil
+}
+
+// ネットワークアドレスとして使用できる文字か判定する
+func isNetworkChar(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		c == '.' || c == ':' || c == '/' || c == '-' || c == '[' || c == ']' || c == '%'
+}
+
+// 値の先頭から、ネットワークアドレスとして解析できる文字列か判定する
+func isNetwork(text []byte, cnt int) bool {
+	var i = cnt
+	// IPv4 アドレスは . を3つ、それ以外は : を含む。含まない場合は、変換せずに対象外とする
+	var dots, colons int
+	var count = func(c byte) {
+		switch c {
+		case '.':
+			dots++
+		case ':':
+			colons++
+		}
+	}
+	// [::1]:8080 形式の場合は、] の後の :ポート番号 までを対象とする
+	if i < len(text) && text[i] == '[' {
+		for i < len(text) && text[i] != ']' && isNetworkChar(text[i]) {
+			count(text[i])
+			i++
+		}
+		if i < len(text) && text[i] == ']' {
+			i++
+		}
+	}
+	for i < len(text) && isNetworkChar(text[i]) && text[i] != '[' && text[i] != ']' {
+		count(text[i])
+		i++
+	}
+	if dots != 3 && colons == 0 {
+		return false
+	}
+	param := string(text[cnt:i])
+	if _, ok := parseNetwork(param); ok {
+		return true
+	}
+	// IPアドレスに % が続く場合は、ゾーンの誤りとしてネットワークアドレスのエラーを報告する
+	if n := strings.IndexByte(param, '%'); n > 0 && net.ParseIP(strings.TrimPrefix(param[:n], "[")) != nil {
+		return true
+	}
+	// ポート番号のみが誤っている場合は、ネットワークアドレスとしてエラーを報告する
+	return invalidPort(param)
+}
+
+// ネットワークアドレスを解析する。CIDR は *net.IPNet、IPアドレスは net.IP、
+// ゾーン付きの IPv6 アドレス、ホスト名:ポート番号は文字列を返却する
+func parseNetwork(param string) (interface{}, bool) {
+	// CIDR
+	if strings.Contains(param, "/") {
+		_, ipnet, err := net.ParseCIDR(param)
+		if err != nil {
+			return nil, false
+		}
+		return ipnet, true
+	}
+	// IPアドレス
+	if ip := net.ParseIP(param); ip != nil {
+		return ip, true
+	}
+	// ゾーン付きの IPv6 アドレス。net.IP はゾーンを保持できないため、文字列として扱う
+	if isZoned(param) {
+		return param, true
+	}
+	// ホスト名:ポート番号
+	host, port, err := net.SplitHostPort(param)
+	if err != nil || !isPort(port) {
+		return nil, false
+	}
+	if host != "" && net.ParseIP(host) == nil && !isZoned(host) && !isHostname(host) {
+		return nil, false
+	}
+	return net.JoinHostPort(host, port), true
+}
+
+// ポート番号として正しいかチェックする
+func isPort(port string) bool {
+	if port == "" || port[0] < '0' || port[0] > '9' {
+		return false
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	return err == nil && n <= 65535
+}
+
+// ホスト名:ポート番号の形式で、ポート番号が範囲外の数字か判定する
+func invalidPort(param string) bool {
+	host, port, err := net.SplitHostPort(param)
+	if err != nil || port == "" || strings.Trim(port, "0123456789") != "" || isPort(port) {
+		return false
+	}
+	return host == "" || net.ParseIP(host) != nil || isZoned(host) || isHostname(host)
+}
+
+// fe80::1%eth0 形式の、ゾーン付きの IPv6 アドレスかチェックする
+func isZoned(param string) bool {
+	i := strings.IndexByte(param, '%')
+	if i < 0 {
+		return false
+	}
+	ip, zone := net.ParseIP(param[:i]), param[i+1:]
+	if ip == nil || ip.To4() != nil || zone == "" {
+		return false
+	}
+	return strings.Trim(zone, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-") == ""
+}
+
+// ホスト名として正しいかチェックする。数字のみのホスト名は、時刻等と区別できないため認めない
+func isHostname(host string) bool {
+	var alpha bool
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+				alpha = true
+			case c >= '0' && c <= '9', c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return alpha
+}
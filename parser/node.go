@@ -2,12 +2,16 @@ package parser
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
+	"unicode"
+
+	"github.com/ochipin/config/internal/lookup"
 )
 
 // Node インターフェースは、Value構造体を継承した構造体を取り扱う
 type Node interface {
-	Text() []byte                      // Value.text を返却する
+	Text() []byte                      // 解析する文字列を返却する
 	Stat() int                         // Value.stat を返却する
 	Pos() int                          // Value.pos を返却する
 	End() int                          // Value.end を返却する
@@ -19,17 +23,46 @@ type Node interface {
 
 // Value 構造体は、あるルールに基づく文字列から、適切な型と値
 type Value struct {
-	text []byte // 解析する文字列
-	stat int    // 解析状態
-	pos  int    // 解析開始位置
-	end  int    // 解析終了位置
-	cnt  int    // textの現在参照している位置
-	key  string // キー名
+	src  *source  // 解析する文字列
+	stat int      // 解析状態
+	pos  int      // 解析開始位置
+	end  int      // 解析終了位置
+	cnt  int      // 解析する文字列の現在参照している位置
+	key  string   // キー名
+	opts *options // パーサのオプション
+}
+
+// NewValue 関数は、親ノード p の参照位置を引き継いだ Value を生成する。独自のノードを実装する際に使用する
+func NewValue(p Node) Value {
+	return Value{
+		src:  sourceOf(p),
+		cnt:  p.Getidx(),
+		pos:  p.Pos(),
+		end:  p.End(),
+		key:  p.Keyname(),
+		opts: optionsOf(p),
+	}
 }
 
-// Text 関数は、処理する文字列を[]byteで返却する
+// option 関数は、パーサのオプションを返却する
+func (v *Value) option() *options {
+	if v.opts == nil {
+		return &defaultOptions
+	}
+	return v.opts
+}
+
+// Text 関数は、処理する文字列を[]byteで返却する。io.Reader から解析する場合、読み込みに合わせて内容が変わるため、参照の都度コールする
 func (v *Value) Text() []byte {
-	return v.text
+	if v.src == nil {
+		return nil
+	}
+	return v.src.text
+}
+
+// source 関数は、解析する文字列を管理する構造体を返却する
+func (v *Value) source() *source {
+	return v.src
 }
 
 // Pos 関数は、解析する位置を返却する
@@ -42,6 +75,16 @@ func (v *Value) End() int {
 	return v.end
 }
 
+// SetEnd 関数は、解析終了位置をセットする
+func (v *Value) SetEnd(i int) {
+	v.end = i
+}
+
+// SetStat 関数は、解析状態をセットする。解析が完了した場合は、ParserNone をセットする
+func (v *Value) SetStat(stat int) {
+	v.stat = stat
+}
+
 // Cnt 関数は、現在参照している位置をセットする
 func (v *Value) Cnt(i int) {
 	v.cnt = i
@@ -64,7 +107,33 @@ func (v *Value) Keyname() string {
 
 // Param 関数は、値を返却する
 func (v *Value) Param() string {
-	return string(v.text[v.pos:v.end])
+	return joinLines(string(v.Text()[v.pos:v.end]))
+}
+
+// 行継続の \, 改行、継続する行の先頭の空白にマッチする正規表現
+var regexpContinuation = regexp.MustCompile(`\\\n[ \t]*`)
+
+// 行継続の \, 改行、継続する行の先頭の空白を除去する
+func joinLines(param string) string {
+	if !strings.Contains(param, "\\\n") {
+		return param
+	}
+	return regexpContinuation.ReplaceAllString(param, "")
+}
+
+// タブ、Unicode の空白、BOM を含む、改行以外の空白文字か判定する
+func isSpace(r rune) bool {
+	return r != '\n' && (unicode.IsSpace(r) || r == '\uFEFF')
+}
+
+// 前後の空白文字を除去する
+func trimSpace(s string) string {
+	return strings.TrimFunc(s, isSpace)
+}
+
+// 空白文字を含むか判定する
+func hasSpace(s string) bool {
+	return strings.IndexFunc(s, isSpace) != -1
 }
 
 // Trim 関数は、指定された1文字のみ、先頭/最後尾から除去する
@@ -87,23 +156,40 @@ func (v *Value) Prev(i int) byte {
 	if v.cnt == 0 || i == 0 || v.cnt-i < 0 {
 		return 0
 	}
-	return v.text[v.cnt-i]
+	return v.Text()[v.cnt-i]
 }
 
 // Set 関数は、取得したキーで、値をdataへ格納する
 func Set(keynames string, value, i interface{}, mode string) error {
 	// ex) app.key.name ---> app, key, name へ分割して処理
-	var keys = strings.Split(mode+"."+keynames, ".")
+	return setKeys(strings.Split(keynames, "."), value, i, mode, false, nil)
+}
+
+// 分割済みのキー名で、値をdataへ格納する。fold が true の場合は、大文字、小文字を区別せずにキー名の重複を判定する。
+// キーが重複した場合は dup をコールし、true の場合は上書き、false の場合は格納しない。dup が nil の場合は、エラーとする
+func setKeys(names []string, value, i interface{}, mode string, fold bool, dup func(path []string) (bool, error)) error {
+	var keys = append([]string{mode}, names...)
 	var last string
 	if len(keys) > 1 {
 		// app key name 等複数ある場合は、最後のキーのみ、別変数へ格納する
 		last = keys[len(keys)-1]
 		keys = keys[:len(keys)-1]
 	}
+	// 重複時の扱いを判定する
+	var overwrite = func(path []string) (bool, error) {
+		if dup == nil {
+			return false, fmt.Errorf("\"%s\" already exists", joinKey(names))
+		}
+		return dup(path)
+	}
 
 	// 指定されたキー分ループし、情報を構築する
 	data, _ := i.(map[string]interface{})
-	for _, key := range keys {
+	for n, key := range keys {
+		// モード名以外は、既存のキー名の表記に合わせる
+		if n > 0 {
+			key = lookup.Key(data, key, fold)
+		}
 		if v1, ok := data[key]; !ok {
 			// data[key] がnilの場合、生成する
 			data[key] = make(map[string]interface{})
@@ -113,15 +199,23 @@ func Set(keynames string, value, i interface{}, mode string) error {
 				// 存在した場合、次の要素を指定する
 				data = v2
 			} else {
-				// 存在するが、map[string]interface{}型ではない場合、エラーとする
-				return fmt.Errorf("\"%s\" already exists", keynames)
+				// 存在するが、map[string]interface{}型ではない場合は、重複として扱う
+				if ok, err := overwrite(names[:n]); !ok || err != nil {
+					return err
+				}
+				data[key] = make(map[string]interface{})
+				data = data[key].(map[string]interface{})
 			}
 		}
 	}
 
-	// 既にデータがある場合は、エラーとする
-	if _, ok := data[last]; ok {
-		return fmt.Errorf("\"%s\" already exists", keynames)
+	// 既にデータがある場合は、重複として扱う
+	key := lookup.Key(data, last, fold)
+	if _, ok := data[key]; ok {
+		if ok, err := overwrite(names); !ok || err != nil {
+			return err
+		}
+		last = key
 	}
 	// 値をセット
 	data[last] = value
@@ -1,589 +1,635 @@
 package parser
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // 日付チェック用正規表現
-var regexpDate = regexp.MustCompile(`^\d{4}\-\d{2}\-\d{2}\s\d{2}:\d{2}:\d{2}$`)
+var (
+	regexpDate     = regexp.MustCompile(`^\d{4}\-\d{2}\-\d{2}[T\s]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[\+\-]\d{2}:\d{2})?$`)
+	regexpDateOnly = regexp.MustCompile(`^\d{4}\-\d{2}\-\d{2}$`)
+	regexpTimeOnly = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?$`)
+)
+
+// 日付、時刻を解析する。タイムゾーンの指定がない場合は、loc のタイムゾーンとして扱う
+func parseDatetime(param string, loc *time.Location) (time.Time, bool) {
+	var result time.Time
+	var err error
+	switch {
+	// 2018-03-10 14:32:11, 2018-03-10T14:32:11.123+09:00 等
+	case regexpDate.MatchString(param):
+		param = strings.Replace(param, "T", " ", 1)
+		if strings.HasSuffix(param, "Z") || strings.LastIndexAny(param, "+-") > len("2006-01-02") {
+			result, err = time.Parse("2006-01-02 15:04:05Z07:00", param)
+		} else {
+			result, err = time.ParseInLocation("2006-01-02 15:04:05", param, loc)
+		}
+	// 2018-03-10
+	case regexpDateOnly.MatchString(param):
+		result, err = time.ParseInLocation("2006-01-02", param, loc)
+	// 09:30:00
+	case regexpTimeOnly.MatchString(param):
+		result, err = time.ParseInLocation("15:04:05", param, loc)
+	default:
+		return result, false
+	}
+	return result, err == nil
+}
+
+// 値の先頭が、日付、時刻の書式か判定する
+func isDatetime(text []byte, cnt int) bool {
+	return hasLayout(text[cnt:], "0000-00-00") || hasLayout(text[cnt:], "00:00:")
+}
+
+// text の先頭が、layout の書式と一致するか判定する。layout の 0 は、任意の数字とする
+func hasLayout(text []byte, layout string) bool {
+	if len(text) < len(layout) {
+		return false
+	}
+	for i := 0; i < len(layout); i++ {
+		if layout[i] == '0' && (text[i] < '0' || text[i] > '9') || layout[i] != '0' && text[i] != layout[i] {
+			return false
+		}
+	}
+	return true
+}
 
 // Number 構造体は、数字の並びを解析し、整数、小数点、日付等を返却する
 type Number struct {
-	Value       // Value構造体をミックスイン
-	sign   bool // +/-の符号付きの場合 true
-	signok bool // +/-の符号の次に付与される数字を判定するために使用する
-	keep   int  // 解析状態の維持
-	array  bool // 配列内の値として使用される場合 true
+	lexer      // lexer 構造体をミックスイン
+	kind  int  // 値の先頭の文字で判定した解析状態
+	sign  bool // +/-の符号付きの場合 true
 }
 
 // NewNumber 関数は、数字解析ノードを生成する
 func NewNumber(p Node) Node {
 	var text = p.Text()
 	var cnt = p.Getidx()
-	// +/- 符号が付いている場合 true とする
-	var sign = text[cnt] == '+' || text[cnt] == '-'
 	// 先頭が 0 から始まらない場合は、整数か、小数点、もしくは日付として判定処理を開始する
-	var stat = ParserNumber
+	var kind = ParserNumber
 	// もし先頭が 0 から始まっていた場合は、8/16進数の可能性を考慮するステータスに変更する
 	if text[cnt] == '0' {
-		stat = ParserNumberAny
+		kind = ParserNumberAny
+	}
+	// 日付、時刻の書式の場合は、日付として判定処理を開始する
+	if isDatetime(text, cnt) {
+		kind = ParserNumberDate
+	}
+	// inf, nan の場合は、特殊な小数点として判定処理を開始する
+	if isSpecialFloat(text, cnt) {
+		kind = ParserNumberSpecial
 	}
-	_, ok := p.(*Array)
 	return &Number{
-		Value: Value{
-			text: text,
-			stat: stat,
-			cnt:  cnt,
-			pos:  p.Pos(),
-			end:  p.End(),
-			key:  p.Keyname(),
-		},
-		array:  ok,
-		sign:   sign,
-		signok: sign,
+		lexer: newLexer(p, ParserValue),
+		kind:  kind,
+		// +/- 符号が付いている場合 true とする
+		sign: text[cnt] == '+' || text[cnt] == '-',
 	}
 }
 
-// Analyze 関数は、真偽値解析を実施する
-func (number *Number) Analyze(b byte) (i interface{}, err error) {
-	// コメント行の場合
-	if number.stat == ParserComment {
-		if b != '\n' {
-			return
+// Analyze 関数は、数字を解析する。値の終わりに達した時点で、整数、小数点、日付等へ変換する
+func (number *Number) Analyze(b byte) (interface{}, error) {
+	tok, ok := number.scan(b)
+	if !ok {
+		return nil, nil
+	}
+	// 値の先頭の文字で判定した状態から、2文字目以降の文字で解析状態を決定する。空白は読み飛ばす
+	var stat = number.kind
+	for i := 1; i < len(tok.text); i++ {
+		if r, size := utf8.DecodeRuneInString(tok.text[i:]); isSpace(r) {
+			i += size - 1
+			continue
+		}
+		next, err := number.next(stat, tok.text, i)
+		if err != nil {
+			return nil, err
 		}
-		number.stat = number.keep
+		stat = next
+	}
+	return number.convert(stat, trimSpace(tok.text))
+}
+
+// 時間の単位の先頭文字か判定する。0xC2 は、µs の µ の1バイト目
+func isTimeUnit(c byte) bool {
+	switch c {
+	case 'n', 'u', 'm', 's', 'h', 'd', 'w', 0xC2:
+		return true
 	}
-	switch number.stat {
+	return false
+}
+
+// サイズの単位の先頭文字か判定する
+func isSizeUnit(c byte) bool {
+	switch c {
+	case 'B', 'k', 'K', 'M', 'G', 'T', 'P', 'E':
+		return true
+	}
+	return false
+}
+
+// 値 param の i 文字目から、次の解析状態を返却する。解析状態で使用できない文字の場合は、エラーとする
+func (number *Number) next(stat int, param string, i int) (int, error) {
+	var c = param[i]
+	switch stat {
 	// 小数点、8進数、16進数のいずれかの場合
 	case ParserNumberAny:
-		i, err = number.parseNumberAny(b)
+		switch {
+		case c >= '0' && c <= '7':
+			return ParserNumberOct, nil
+		case c == 'x':
+			return ParserNumberHex, nil
+		case c == 'b':
+			return ParserNumberBin, nil
+		case c == '.':
+			return ParserNumberFloat, nil
+		case isTimeUnit(c):
+			return ParserNumberTime, nil
+		case isSizeUnit(c):
+			return ParserNumberSize, nil
+		// 8, 9 が指定された場合は、8進数エラーとして扱う
+		case c == '8' || c == '9':
+			return 0, fmt.Errorf("\"%s\" oct invalid value", number.key)
+		}
+		return 0, fmt.Errorf("\"%s\" invalid value", number.key)
 	// 小数点、整数、符号付整数、日付のいずれかの場合
 	case ParserNumber:
-		i, err = number.parseNumber(b)
-	// 整数の場合
+		switch {
+		case c == '.':
+			return ParserNumberFloat, nil
+		// カンマ、アンダースコア区切りの整数の場合
+		case c == ',' || c == '_':
+			return ParserNumberInt, nil
+		// 日付指定の場合。符号付きの場合、日付指定はできない
+		case c == '-':
+			if number.sign {
+				return 0, fmt.Errorf("\"%s = %s\" datetime invalid value", number.key, param[:i+1])
+			}
+			return ParserNumberDate, nil
+		// 符号付き 0 の場合 ex) +0 は、不正とみなしエラーとする
+		case c == '0' && number.sign && i == 1:
+			return 0, fmt.Errorf("\"%s = %s\" oct invalid value", number.key, param[:i+1])
+		case c >= '0' && c <= '9':
+			return stat, nil
+		case isTimeUnit(c):
+			return ParserNumberTime, nil
+		case isSizeUnit(c):
+			return ParserNumberSize, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s\" integer invalid value", number.key, param[:i+1])
+	// 整数の場合。カンマ、アンダースコア区切りでの指定を認める
 	case ParserNumberInt:
-		i, err = number.parseNumberInt(b)
-	// 小数点の場合
+		switch {
+		case c >= '0' && c <= '9', c == ',', c == '_':
+			return stat, nil
+		// 区切り文字付きの小数点の場合 ex) 1_000.5
+		case c == '.':
+			return ParserNumberFloat, nil
+		case isTimeUnit(c):
+			return ParserNumberTime, nil
+		case isSizeUnit(c):
+			return ParserNumberSize, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s\" integer invalid value", number.key, param[:i+1])
+	// 小数点の場合。ex) 1.5s, 1.5GB の単位も認める
 	case ParserNumberFloat:
-		i, err = number.parseNumberFloat(b)
+		switch {
+		case c >= '0' && c <= '9', c == '_':
+			return stat, nil
+		case isTimeUnit(c):
+			return ParserNumberTime, nil
+		case isSizeUnit(c):
+			return ParserNumberSize, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s\" float invalid value", number.key, param[:i+1])
 	// 8進数の場合
 	case ParserNumberOct:
-		i, err = number.parseNumberOct(b)
+		if c >= '0' && c <= '7' || c == '_' {
+			return stat, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s...\" oct invalid value", number.key, param[:i+1])
 	// 16進数の場合
 	case ParserNumberHex:
-		i, err = number.parseNumberHex(b)
-	// 日付の場合
+		if isDigit(c) || c == '_' {
+			return stat, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s...\" hex invalid value", number.key, param[:i+1])
+	// 2進数の場合
+	case ParserNumberBin:
+		if c == '0' || c == '1' || c == '_' {
+			return stat, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s...\" bin invalid value", number.key, param[:i+1])
+	// inf, nan の場合
+	case ParserNumberSpecial:
+		if strings.IndexByte("+-infa", c) != -1 {
+			return stat, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s...\" float invalid value", number.key, param[:i+1])
+	// 日付の場合。0-9, -, :, T, Z, +, . 文字は日付文字として許可
 	case ParserNumberDate:
-		i, err = number.parseNumberDate(b)
-	// 時間指定の場合
+		if c >= '0' && c <= '9' || strings.IndexByte("-:TZ+.", c) != -1 {
+			return stat, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s...\" datetime invalid error", number.key, param[:i+1])
+	// 時間指定の場合。数字、小数点、カンマ、単位の文字は許可する
 	case ParserNumberTime:
-		i, err = number.parseNumberTime(b)
+		if c >= '0' && c <= '9' || c == '.' || c == ',' || c == 0xB5 || isTimeUnit(c) {
+			return stat, nil
+		}
+		return 0, fmt.Errorf("\"%s = %s...\" time invalid error", number.key, param[:i+1])
 	// サイズ指定の場合
 	case ParserNumberSize:
-		i, err = number.parseNumberSize(b)
-	}
-	return i, err
-}
-
-// 小数点、8進数、16進数、いずれか不明な場合にコールされる
-func (number *Number) parseNumberAny(b byte) (interface{}, error) {
-	switch b {
-	// 8進数
-	case '0', '1', '2', '3', '4', '5', '6', '7':
-		number.stat = ParserNumberOct
-		number.end = number.cnt + 1
-	// 16進数
-	case 'x':
-		number.stat = ParserNumberHex
-		number.end = number.cnt + 1
-	// 小数点
-	case '.':
-		number.stat = ParserNumberFloat
-		number.end = number.cnt + 1
-	// 時間指定の場合
-	case 'm', 's', 'h', 'd':
-		number.stat = ParserNumberTime
-		number.end = number.cnt + 1
-	// サイズ指定の場合
-	case 'B', 'K', 'M', 'G', 'T':
-		number.stat = ParserNumberSize
-		number.end = number.cnt + 1
-	// 改行コードがあった場合は、 "0" 以外ありえないので0をセット
-	case '\n':
-		number.stat = ParserNone
-		return 0, nil
-	// 空白はスルーする
-	case ' ':
-	// コメント行
-	case '#':
-		number.keep = ParserNumberAny
-		number.stat = ParserComment
-	// 8, 9 が指定された場合は、8進数エラーとして扱う
-	case '8', '9':
-		return nil, fmt.Errorf("\"%s\" oct invalid value", number.key)
-	// 上記以外
-	default:
-		// 配列の場合、, または]があった時点で終了とする
-		if number.array {
-			if b == ',' || b == ']' {
-				number.stat = ParserNone
-				return 0, nil
-			}
+		if c == 'B' || c == 'i' {
+			return stat, nil
 		}
-		// 不正とみなし、エラーを返却する
-		return nil, fmt.Errorf("\"%s\" invalid value", number.key)
+		return 0, fmt.Errorf("\"%s = %s...\" size invalid error", number.key, param[:i+1])
 	}
-	return nil, nil
+	return 0, fmt.Errorf("\"%s\" invalid value", number.key)
 }
 
-// 小数点、整数、いずれか不明な場合にコールされる
-func (number *Number) parseNumber(b byte) (interface{}, error) {
-	switch b {
+// 解析状態に応じて、値を整数、小数点、日付等へ変換する
+func (number *Number) convert(stat int, param string) (interface{}, error) {
+	switch stat {
+	// "0" 以外ありえないので0をセット
+	case ParserNumberAny:
+		return number.parseInteger("0", "0", false, 10, "integer")
+	// 整数の場合。区切り文字の位置が不正な場合はエラーとなる
+	case ParserNumber, ParserNumberInt:
+		if hasSpace(param) {
+			return nil, fmt.Errorf("\"%s = %s\" integer invalid value", number.key, param)
+		}
+		return number.parseSigned(param)
 	// 小数点の場合
-	case '.':
-		number.stat = ParserNumberFloat
-		number.end = number.cnt + 1
-	// 整数の場合
-	case ',':
-		// 配列内の整数の場合、, があった時点で終了とする
-		if number.array {
-			number.end = number.cnt
-			return number.parseNumber('\n')
-		}
-		number.stat = ParserNumberInt
-		number.end = number.cnt + 1
-	// 日付指定の場合
-	case '-':
-		number.end = number.cnt + 1
-		param := number.Param()
-		// 符号付きの場合、日付指定はできない
-		if number.sign {
-			return nil, fmt.Errorf("\"%s = %s\" datetime invalid value", number.key, param)
+	case ParserNumberFloat:
+		if hasSpace(param) || param[len(param)-1] == '.' {
+			return nil, fmt.Errorf("\"%s = %s\" float invalid value", number.key, param)
 		}
-		number.stat = ParserNumberDate
-	// '0' を指定されている場合 ex) +0
-	case '0':
-		number.end = number.cnt + 1
-		// 符号付き 0 の場合、不正とみなしエラーとする
-		if number.signok {
-			param := number.Param()
+		return number.parseFloat(param)
+	// 8進数の場合
+	case ParserNumberOct:
+		if hasSpace(param) {
 			return nil, fmt.Errorf("\"%s = %s\" oct invalid value", number.key, param)
 		}
-	// 0-9 の場合
-	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		number.end = number.cnt + 1
+		return number.parseInteger(param, param, false, 8, "oct")
+	// 16進数の場合
+	case ParserNumberHex:
+		if hasSpace(param) {
+			return nil, fmt.Errorf("\"%s = %s\" hex invalid value", number.key, param)
+		}
+		return number.parseInteger(param, param[2:], false, 16, "hex")
+	// 2進数の場合
+	case ParserNumberBin:
+		if hasSpace(param) {
+			return nil, fmt.Errorf("\"%s = %s\" bin invalid value", number.key, param)
+		}
+		return number.parseInteger(param, param[2:], false, 2, "bin")
+	// inf, nan の場合
+	case ParserNumberSpecial:
+		result, ok := specialFloats[param]
+		if !ok {
+			return nil, fmt.Errorf("\"%s = %s\" float invalid value", number.key, param)
+		}
+		if number.option().exact {
+			return json.Number(strconv.FormatFloat(result, 'g', -1, 64)), nil
+		}
+		return result, nil
+	// 日付の場合
+	case ParserNumberDate:
+		result, ok := parseDatetime(param, number.option().location)
+		if !ok {
+			return nil, fmt.Errorf("\"%s = %s\" datetime invalid value", number.key, param)
+		}
+		return result, nil
 	// 時間指定の場合
-	case 'm', 's', 'h', 'd':
-		number.stat = ParserNumberTime
-		number.end = number.cnt + 1
-	// サイズ指定の場合
-	case 'B', 'K', 'M', 'G', 'T':
-		number.stat = ParserNumberSize
-		number.end = number.cnt + 1
-	// 改行コードがあった場合終了とする
-	case '\n':
-		// 状態を元に戻す
-		number.stat = ParserNone
-		// 終了ポイントが未設定の場合は設定する
-		// if number.end < number.pos {
-		//	number.end = number.cnt - 1
-		// }
-		// 値を取得
-		param := strings.Trim(number.Param(), " ")
-		// 不正な文字列がないかチェック
-		if strings.Index(param, " ") != -1 {
-			return nil, fmt.Errorf("\"%s = %s\" integer invalid value", number.key, param)
+	case ParserNumberTime:
+		if hasSpace(param) {
+			return nil, fmt.Errorf("\"%s = %s\" time invalid value", number.key, param)
 		}
-		// 取得した値を整数へ変換する
-		result, err := strconv.ParseInt(param, 10, 32)
+		result, err := parseDuration(param)
 		if err != nil {
-			return nil, err
-		}
-		return int(result), nil
-	// 空白はスルーする
-	case ' ':
-	// コメント行
-	case '#':
-		number.end = number.cnt
-		number.keep = ParserNumber
-		number.stat = ParserComment
-	// 上記以外
-	default:
-		// 配列内の整数の場合、, があった時点で終了とする
-		if number.array {
-			if b == ']' {
-				number.end = number.cnt
-				return number.parseNumber('\n')
+			if _, ok := err.(*strconv.NumError); ok {
+				return nil, err
 			}
+			return nil, fmt.Errorf("\"%s = %s\" %s", number.key, param, err)
 		}
-		// エラーを返却する
-		number.end = number.cnt + 1
-		return nil, fmt.Errorf("\"%s = %s\" integer invalid value", number.key, number.Param())
-	}
-	number.signok = false
-	return nil, nil
-}
-
-// 整数(10進数)を処理する場合にコールされる
-func (number *Number) parseNumberInt(b byte) (interface{}, error) {
-	switch b {
-	// 整数は許可する
-	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		number.end = number.cnt + 1
-	// 整数は、カンマ区切りでの指定を認める
-	case ',':
-		number.end = number.cnt + 1
-	// 時間指定の場合
-	case 'm', 's', 'h', 'd':
-		number.stat = ParserNumberTime
-		number.end = number.cnt + 1
+		return result, nil
 	// サイズ指定の場合
-	case 'B', 'K', 'M', 'G', 'T':
-		number.stat = ParserNumberSize
-		number.end = number.cnt + 1
-	// 改行コードがあった時点で、終了とする
-	case '\n':
-		// 状態を元に戻す
-		number.stat = ParserNone
-		// データの取得
-		param := strings.Trim(number.Param(), " ")
-		// データ内に空白が紛れ込んでいた場合は、エラーとする
-		if strings.Index(param, " ") != -1 {
-			return nil, fmt.Errorf("\"%s = %s\" integer invalid value", number.key, param)
-		}
-		// 先頭、最後尾に,が発見された場合は、エラーとする
-		if param != "" && (param[0] == ',' || param[len(param)-1] == ',') {
-			return nil, fmt.Errorf("\"%s = %s\" integer invalid value", number.key, param)
+	case ParserNumberSize:
+		if hasSpace(param) || len(param) < 2 {
+			return nil, fmt.Errorf("\"%s = %s\" size invalid value", number.key, param)
 		}
-		// 数字文字列内に存在する,を除去する
-		param = strings.Replace(param, ",", "", -1)
-		// 整数へ変換する
-		result, err := strconv.ParseInt(param, 10, 32)
+		result, err := parseSize(param, number.option().decimalSize)
 		if err != nil {
-			return nil, err
+			if _, ok := err.(*strconv.NumError); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("\"%s = %s\" %s", number.key, param, err)
 		}
-		return int(result), nil
-	// 空白はスルーする
-	case ' ':
-	// コメント行
-	case '#':
-		number.keep = ParserNumberInt
-		number.stat = ParserComment
-	// 上記以外はエラーとする
-	default:
-		// エラーとする
-		number.end = number.cnt + 1
-		return nil, fmt.Errorf("\"%s = %s\" integer invalid value", number.key, number.Param())
+		return result, nil
 	}
-	return nil, nil
+	return nil, fmt.Errorf("\"%s\" invalid value", number.key)
 }
 
-// 小数点を処理する場合にコールされる
-func (number *Number) parseNumberFloat(b byte) (interface{}, error) {
-	switch b {
-	// 0-9 の数字は許可する
-	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		number.end = number.cnt + 1
-	// 改行コードがあった時点で、終了とする
-	case '\n':
-		// 状態を元に戻す
-		number.stat = ParserNone
-		// 値の取得
-		param := strings.Trim(number.Param(), " ")
-		// 値のチェック
-		if strings.Index(param, " ") != -1 || param[len(param)-1] == '.' {
-			return nil, fmt.Errorf("\"%s = %s\" float invalid value", number.key, param)
-		}
-		result, err := strconv.ParseFloat(param, 32)
-		if err != nil {
-			return nil, err
-		}
-		return float32(result), nil
-	// 空行はスルーする
-	case ' ':
-	// コメント行は無視するよう、状態を変更する
-	case '#':
-		number.keep = ParserNumberFloat
-		number.stat = ParserComment
-	// 上記以外は、小数点には使用できない文字列とする
+// inf, nan として扱う値
+var specialFloats = map[string]float64{
+	"inf":  math.Inf(1),
+	"+inf": math.Inf(1),
+	"-inf": math.Inf(-1),
+	"nan":  math.NaN(),
+}
+
+// inf, nan として判定する値。+nan, -nan は、float の誤りとして報告するために判定のみ行う
+var specialFloatNames = []string{"inf", "+inf", "-inf", "nan", "+nan", "-nan"}
+
+// 値の先頭が、inf, nan か判定する
+func isSpecialFloat(text []byte, cnt int) bool {
+	switch text[cnt] {
+	case '+', '-', 'i', 'n':
 	default:
-		// 配列内の整数の場合、, があった時点で終了とする
-		if number.array {
-			if b == ',' || b == ']' {
-				number.end = number.cnt
-				return number.parseNumberFloat('\n')
-			}
+		return false
+	}
+	for _, name := range specialFloatNames {
+		end := cnt + len(name)
+		if end > len(text) || string(text[cnt:end]) != name {
+			continue
+		}
+		// infinity 等、後続に英数字が続く場合は対象外とする
+		if end == len(text) || !isDigit(text[end]) && (text[end] < 'g' || text[end] > 'z') && (text[end] < 'G' || text[end] > 'Z') {
+			return true
 		}
-		number.end = number.cnt + 1
-		return nil, fmt.Errorf("\"%s = %s\" float invalid value", number.key, number.Param())
 	}
-	return nil, nil
+	return false
 }
 
-// 8進数を処理する場合にコールされる
-func (number *Number) parseNumberOct(b byte) (interface{}, error) {
-	switch b {
-	// 0-7までの数字の場合は許可する
-	case '0', '1', '2', '3', '4', '5', '6', '7':
-		number.end = number.cnt + 1
-	// 改行コードがあった場合は終了とする
-	case '\n':
-		// 状態を元に戻す
-		number.stat = ParserNone
-		// 値を取得
-		param := strings.Trim(number.Param(), " ")
-		// 値を検証
-		if strings.Index(param, " ") != -1 {
-			return nil, fmt.Errorf("\"%s = %s\" oct invalid value", number.key, param)
-		}
-		result, err := strconv.ParseInt(param, 8, 33)
-		if err != nil {
-			return nil, err
+// 16進数までの数字として使用できる文字か判定する
+func isDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// 数字の区切り文字 (, _) を除去する。区切り文字が数字の間以外に指定されている場合は false を返却する
+func trimSeparator(s string) (string, bool) {
+	if strings.IndexAny(s, ",_") == -1 {
+		return s, s != ""
+	}
+	var buf = make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != ',' && s[i] != '_' {
+			buf = append(buf, s[i])
+			continue
 		}
-		return int(result), nil
-	// 空行はスルーする
-	case ' ':
-	// コメント行
-	case '#':
-		number.keep = ParserNumberOct
-		number.stat = ParserComment
-	// 上記以外はエラーとする
-	default:
-		// 配列内の整数の場合、, があった時点で終了とする
-		if number.array {
-			if b == ',' || b == ']' {
-				number.end = number.cnt
-				return number.parseNumberOct('\n')
-			}
+		if i == 0 || i == len(s)-1 || !isDigit(s[i-1]) || !isDigit(s[i+1]) {
+			return "", false
 		}
-		// エラーとする
-		number.end = number.cnt + 1
-		return nil, fmt.Errorf("\"%s = %s...\" oct invalid value", number.key, number.Param())
 	}
+	return string(buf), true
+}
 
-	return nil, nil
+// 符号付きの10進数を整数へ変換する
+func (number *Number) parseSigned(param string) (interface{}, error) {
+	if param != "" && (param[0] == '+' || param[0] == '-') {
+		return number.parseInteger(param, param[1:], param[0] == '-', 10, "integer")
+	}
+	return number.parseInteger(param, param, false, 10, "integer")
 }
 
-// 16進数を処理する場合にコールされる
-func (number *Number) parseNumberHex(b byte) (interface{}, error) {
-	switch b {
-	// 0-9a-fA-F 文字のみ許可する
-	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		number.end = number.cnt + 1
-	case 'a', 'b', 'c', 'd', 'e', 'f', 'A', 'B', 'C', 'D', 'E', 'F':
-		number.end = number.cnt + 1
-	// 改行コードがあった場合終了とする
-	case '\n':
-		// 状態を元に戻す
-		number.stat = ParserNone
-		// 値を取得
-		param := strings.Trim(number.Param(), " ")
-		// 不正な文字列でないかチェック
-		if strings.Index(param, " ") != -1 || len(param) == 2 {
-			return nil, fmt.Errorf("\"%s = %s\" hex invalid value", number.key, param)
+// 整数を解析する。digits は、param から符号、0x/0b の接頭辞を除いた数字の並び。
+// ExactNumbers オプション指定時は、桁数の制限なく json.Number として返却する
+func (number *Number) parseInteger(param, digits string, neg bool, base int, kind string) (interface{}, error) {
+	s, ok := trimSeparator(digits)
+	if !ok {
+		return nil, fmt.Errorf("\"%s = %s\" %s invalid value", number.key, param, kind)
+	}
+	if number.option().exact {
+		n, ok := new(big.Int).SetString(s, base)
+		if !ok {
+			return nil, fmt.Errorf("\"%s = %s\" %s invalid value", number.key, param, kind)
 		}
-		result, err := strconv.ParseInt(param[2:], 16, 33)
-		if err != nil {
-			return nil, err
+		if neg {
+			n.Neg(n)
 		}
-		return int(result), nil
-	// 空行はスルーする
-	case ' ':
-	// コメント行
-	case '#':
-		number.keep = ParserNumberHex
-		number.stat = ParserComment
-	// 上記以外はエラーとする
-	default:
-		// 配列内の整数の場合、, があった時点で終了とする
-		if number.array {
-			if b == ',' || b == ']' {
-				number.end = number.cnt
-				return number.parseNumberHex('\n')
-			}
+		return json.Number(n.String()), nil
+	}
+	u, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
+			return nil, &strconv.NumError{Func: "ParseInt", Num: param, Err: strconv.ErrRange}
 		}
-		number.end = number.cnt + 1
-		return nil, fmt.Errorf("\"%s = %s...\" hex invalid value", number.key, number.Param())
+		return nil, fmt.Errorf("\"%s = %s\" %s invalid value", number.key, param, kind)
 	}
-	return nil, nil
+	return intValue(u, neg, param)
 }
 
-// 日付を解析する
-func (number *Number) parseNumberDate(b byte) (interface{}, error) {
-	switch b {
-	case '\n':
-		// 状態を元に戻す
-		number.stat = ParserNone
-		// 取得したパラメータが正しいか検証
-		param := strings.Trim(number.Param(), " ")
-		if !regexpDate.MatchString(param) {
-			return nil, fmt.Errorf("\"%s = %s\" datetime invalid value", number.key, param)
-		}
-		// 日付型へ変換する
-		result, err := time.Parse("2006-01-02 15:04:05", param)
-		// 変換失敗の場合はエラーを返却
-		if err != nil {
-			return nil, fmt.Errorf("\"%s = %s\" datetime invalid value", number.key, param)
-		}
-		return result, nil
-	// 0-9, -, : 文字は日付文字として許可
-	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '-', ':':
-		number.end = number.cnt + 1
-	// 空白はスルーする
-	case ' ':
-	// コメント行とする
-	case '#':
-		number.end = number.cnt
-		number.stat = ParserComment
-		number.keep = ParserNumberDate
-	// 上記以外
-	default:
-		// 配列内の値の場合、, or ] があった時点で終了とする
-		if number.array {
-			if b == ',' || b == ']' {
-				number.end = number.cnt
-				return number.parseNumberDate('\n')
-			}
-		}
-		// 不正とみなしエラーとする
-		number.end = number.cnt + 1
-		return nil, fmt.Errorf("\"%s = %s...\" datetime invalid error", number.key, number.Param())
+// 整数を、値の範囲に応じて int, int64, uint64 のいずれかの型で返却する
+func intValue(u uint64, neg bool, param string) (interface{}, error) {
+	switch {
+	// int64 の範囲を超える負の値は、範囲外エラーとする
+	case neg && u > 1<<63:
+		return nil, &strconv.NumError{Func: "ParseInt", Num: param, Err: strconv.ErrRange}
+	case neg:
+		n := int64(-u)
+		if n >= math.MinInt {
+			return int(n), nil
+		}
+		return n, nil
+	case u <= math.MaxInt:
+		return int(u), nil
+	case u <= math.MaxInt64:
+		return int64(u), nil
 	}
-	return nil, nil
+	return u, nil
 }
 
-// 1ms, 1s, 1m, 1h, 1d などの時間指定の場合
-func (number *Number) parseNumberTime(b byte) (interface{}, error) {
-	switch b {
-	case 's':
-		if number.Prev(1) != 'm' {
-			return nil, fmt.Errorf("\"%s = %s...\" time invalid error", number.key, number.Param())
-		}
-		number.end = number.cnt + 1
-	case '\n':
-		// 状態を元に戻す
-		number.stat = ParserNone
-		// 取得したパラメータが正しいか検証
-		param := strings.Trim(number.Param(), " ")
-		// 不正な文字列でないかチェック
-		if strings.Index(param, " ") != -1 || len(param) < 2 {
-			return nil, fmt.Errorf("\"%s = %s\" time invalid value", number.key, param)
+// 小数点を解析する。ExactNumbers オプション指定時は、記述した値のまま json.Number として返却する
+func (number *Number) parseFloat(param string) (interface{}, error) {
+	s, ok := trimSeparator(param)
+	if !ok {
+		return nil, fmt.Errorf("\"%s = %s\" float invalid value", number.key, param)
+	}
+	if number.option().exact {
+		return json.Number(strings.TrimPrefix(s, "+")), nil
+	}
+	result, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
+			return nil, &strconv.NumError{Func: "ParseFloat", Num: param, Err: strconv.ErrRange}
 		}
-		// 単位を求める
-		var unit int64
-		var numstr = param[:len(param)-1]
-		switch param[len(param)-1] {
-		case 's':
-			unit = 1000
-			if param[len(param)-2] == 'm' {
-				unit = 1
-				numstr = numstr[:len(numstr)-1]
+		return nil, fmt.Errorf("\"%s = %s\" float invalid value", number.key, param)
+	}
+	return result, nil
+}
+
+// 時間の単位
+var durationUnits = []struct {
+	name string
+	unit time.Duration
+}{
+	// 先頭から順に一致を判定するため、2文字の単位を先に並べる
+	{"ns", time.Nanosecond},
+	{"us", time.Microsecond},
+	{"µs", time.Microsecond},
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+}
+
+// 1h30m, 1.5s, 1,000ms 等の時間表記を解析する
+func parseDuration(param string) (time.Duration, error) {
+	var s = param
+	var neg bool
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	if s == "" {
+		return 0, fmt.Errorf("time invalid value")
+	}
+
+	var total uint64
+	for s != "" {
+		// 数字部分を取得する。整数部はカンマ区切りを認める
+		var i int
+		for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == ',' || s[i] == '.') {
+			i++
+		}
+		numstr := s[:i]
+		s = s[i:]
+		if numstr == "" || numstr[0] == ',' || numstr[len(numstr)-1] == ',' || strings.Contains(numstr, ",,") {
+			return 0, fmt.Errorf("time invalid value")
+		}
+		intstr, fracstr := numstr, ""
+		if i := strings.Index(numstr, "."); i != -1 {
+			intstr, fracstr = numstr[:i], numstr[i+1:]
+			if intstr == "" || fracstr == "" || strings.ContainsAny(fracstr, ",.") || intstr[len(intstr)-1] == ',' {
+				return 0, fmt.Errorf("time invalid value")
 			}
-		case 'm':
-			unit = 1000 * 60
-		case 'h':
-			unit = 1000 * 60 * 60
-		case 'd':
-			unit = 86400 * 1000
-		}
-		// 先頭、最後尾に,が発見された場合は、エラーとする
-		if numstr != "" && (numstr[0] == ',' || numstr[len(numstr)-1] == ',') {
-			return nil, fmt.Errorf("\"%s = %s\" size invalid value", number.key, numstr)
-		}
-		// 数字文字列内に存在する,を除去する
-		numstr = strings.Replace(numstr, ",", "", -1)
-		// 整数変換開始
-		num, err := strconv.ParseInt(numstr, 10, 64)
-		if err != nil {
-			return nil, err
 		}
-		return num * unit, nil
-	case ' ':
-	case '#':
-		number.end = number.cnt
-		number.keep = number.stat
-		number.stat = ParserComment
-	default:
-		// 配列内の値の場合、, or ] があった時点で終了とする
-		if number.array {
-			if b == ',' || b == ']' {
-				number.end = number.cnt
-				return number.parseNumberTime('\n')
+
+		// 単位を取得する
+		var unit time.Duration
+		for _, u := range durationUnits {
+			if strings.HasPrefix(s, u.name) {
+				unit = u.unit
+				s = s[len(u.name):]
+				break
 			}
 		}
-		// 不正とみなしエラーとする
-		number.end = number.cnt + 1
-		return nil, fmt.Errorf("\"%s = %s...\" time invalid error", number.key, number.Param())
+		if unit == 0 {
+			return 0, fmt.Errorf("time invalid value")
+		}
+
+		// 整数部を計算する。オーバーフローした場合は、範囲外エラーとする
+		n, err := strconv.ParseUint(strings.Replace(intstr, ",", "", -1), 10, 64)
+		if err != nil || n > uint64(math.MaxInt64)/uint64(unit) {
+			return 0, &strconv.NumError{Func: "ParseDuration", Num: param, Err: strconv.ErrRange}
+		}
+		v := n * uint64(unit)
+		// 小数部を計算する
+		if fracstr != "" {
+			f, _ := strconv.ParseFloat("0."+fracstr, 64)
+			v += uint64(f*float64(unit) + 0.5)
+		}
+		total += v
+		if total > math.MaxInt64 {
+			return 0, &strconv.NumError{Func: "ParseDuration", Num: param, Err: strconv.ErrRange}
+		}
+	}
+	if neg {
+		return -time.Duration(total), nil
 	}
-	return nil, nil
+	return time.Duration(total), nil
 }
 
-// 1KB, 1MB, 1GB, 1TB などのサイズ指定の場合
-func (number *Number) parseNumberSize(b byte) (interface{}, error) {
-	switch b {
-	case 'B':
-		number.end = number.cnt + 1
-	case '\n':
-		// 状態を元に戻す
-		number.stat = ParserNone
-		// 取得したパラメータが正しいか検証
-		param := strings.Trim(number.Param(), " ")
-		// 不正な文字列でないかチェック
-		if strings.Index(param, " ") != -1 || len(param) < 2 {
-			return nil, fmt.Errorf("\"%s = %s\" size invalid value", number.key, param)
+// サイズの単位
+var sizeUnits = map[string]struct {
+	binary  int64 // 2の累乗での値
+	decimal int64 // 10の累乗での値
+}{
+	"B":   {1, 1},
+	"kB":  {1000, 1000},
+	"KB":  {1 << 10, 1000},
+	"MB":  {1 << 20, 1000 * 1000},
+	"GB":  {1 << 30, 1000 * 1000 * 1000},
+	"TB":  {1 << 40, 1000 * 1000 * 1000 * 1000},
+	"PB":  {1 << 50, 1000 * 1000 * 1000 * 1000 * 1000},
+	"EB":  {1 << 60, 1000 * 1000 * 1000 * 1000 * 1000 * 1000},
+	"KiB": {1 << 10, 1 << 10},
+	"MiB": {1 << 20, 1 << 20},
+	"GiB": {1 << 30, 1 << 30},
+	"TiB": {1 << 40, 1 << 40},
+	"PiB": {1 << 50, 1 << 50},
+	"EiB": {1 << 60, 1 << 60},
+}
+
+// 1KB, 1.5GiB, 1,000MB 等のサイズ表記を解析する。decimal が true の場合、KB, MB 等を10の累乗として扱う
+func parseSize(param string, decimal bool) (int64, error) {
+	// 単位を取得する
+	var i = len(param)
+	for i > 0 && (param[i-1] < '0' || param[i-1] > '9') && param[i-1] != ',' && param[i-1] != '.' {
+		i--
+	}
+	numstr, name := param[:i], param[i:]
+	u, ok := sizeUnits[name]
+	if !ok {
+		return 0, fmt.Errorf("size invalid value")
+	}
+	unit := u.binary
+	if decimal {
+		unit = u.decimal
+	}
+
+	// 符号を取得する。負のサイズは指定できない
+	if numstr != "" && (numstr[0] == '+' || numstr[0] == '-') {
+		if numstr[0] == '-' {
+			return 0, fmt.Errorf("size can not be negative")
 		}
-		// 単位を求める
-		var unit int64 = 1
-		var idx = 2
-		switch param[len(param)-idx:] {
-		case "KB":
-			unit = 1024
-		case "MB":
-			unit = 1024 * 1024
-		case "GB":
-			unit = 1024 * 1024 * 1024
-		case "TB":
-			unit = 1024 * 1024 * 1024 * 1024
-		default:
-			// Bのみの場合、Byte として扱う
-			if param[len(param)-1] == 'B' {
-				idx = 1
-			}
+		numstr = numstr[1:]
+	}
+	intstr, fracstr := numstr, ""
+	if i := strings.Index(numstr, "."); i != -1 {
+		intstr, fracstr = numstr[:i], numstr[i+1:]
+		if fracstr == "" || strings.ContainsAny(fracstr, ",.") {
+			return 0, fmt.Errorf("size invalid value")
 		}
-		// ユニットを削除
-		param = param[:len(param)-idx]
-		// 先頭、最後尾に,が発見された場合は、エラーとする
-		if param != "" && (param[0] == ',' || param[len(param)-1] == ',') {
-			return nil, fmt.Errorf("\"%s = %s\" size invalid value", number.key, param)
+	}
+	// 先頭、最後尾に,が発見された場合は、エラーとする
+	if intstr == "" || intstr[0] == ',' || intstr[len(intstr)-1] == ',' || strings.Contains(intstr, ",,") {
+		return 0, fmt.Errorf("size invalid value")
+	}
+
+	// 整数部を計算する。オーバーフローした場合は、範囲外エラーとする
+	n, err := strconv.ParseInt(strings.Replace(intstr, ",", "", -1), 10, 64)
+	if err != nil || n > math.MaxInt64/unit {
+		return 0, &strconv.NumError{Func: "ParseSize", Num: param, Err: strconv.ErrRange}
+	}
+	v := n * unit
+	// 小数部を計算する。1バイト未満の端数が出る値は、エラーとする
+	if fracstr != "" {
+		if unit == 1 {
+			return 0, fmt.Errorf("size invalid value")
 		}
-		// 数字文字列内に存在する,を除去する
-		param = strings.Replace(param, ",", "", -1)
-		// 整数変換開始
-		num, err := strconv.ParseInt(param, 10, 64)
-		if err != nil {
-			return nil, err
+		r, ok := new(big.Rat).SetString("0." + fracstr)
+		if !ok {
+			return 0, fmt.Errorf("size invalid value")
 		}
-		return num * unit, nil
-	case ' ':
-	case '#':
-		number.end = number.cnt
-		number.keep = number.stat
-		number.stat = ParserComment
-	default:
-		// 配列内の値の場合、, or ] があった時点で終了とする
-		if number.array {
-			if b == ',' || b == ']' {
-				number.end = number.cnt
-				return number.parseNumberSize('\n')
-			}
+		if r = r.Mul(r, new(big.Rat).SetInt64(unit)); !r.IsInt() {
+			return 0, fmt.Errorf("size is not a whole number of bytes")
+		}
+		frac := r.Num().Int64()
+		if v > math.MaxInt64-frac {
+			return 0, &strconv.NumError{Func: "ParseSize", Num: param, Err: strconv.ErrRange}
 		}
-		// 不正とみなしエラーとする
-		number.end = number.cnt + 1
-		return nil, fmt.Errorf("\"%s = %s...\" size invalid error", number.key, number.Param())
+		v += frac
 	}
-	return nil, nil
+	return v, nil
 }
@@ -0,0 +1,148 @@
+package parser
+
+import "time"
+
+// キー名の大文字、小文字の扱い
+const (
+	keyLower         = iota // 小文字へ変換する (既定値)
+	keyPreserve             // 変換しない。重複は、大文字、小文字を区別せずに判定する
+	keyCaseSensitive        // 変換しない。大文字、小文字を区別する
+)
+
+// キー名が重複した場合の扱い
+const (
+	duplicateError     = iota // エラーとする (既定値)
+	duplicateLastWins         // 後から定義した値で上書きする
+	duplicateFirstWins        // 先に定義した値を使用する
+)
+
+// Option は、パーサの動作を変更するオプション
+type Option func(*options)
+
+// パーサのオプション設定値
+type options struct {
+	location    *time.Location // タイムゾーンの指定がない日付、時刻に使用するタイムゾーン
+	decimalSize bool           // KB, MB 等のサイズ単位を、10の累乗として扱う場合 true
+	exact       bool           // 整数、小数点を json.Number として扱う場合 true
+	unicodeKeys bool           // 引用符で囲まれていないキー名に、Unicode の文字を許可する場合 true
+	keyCase     int            // キー名の大文字、小文字の扱い
+	duplicate   int            // キー名が重複した場合の扱い
+	maxInput    int            // 設定ファイルの最大バイト数。0 の場合は制限しない
+	maxDepth    int            // キー名の階層、配列の入れ子の最大の深さ。0 の場合は制限しない
+	maxArray    int            // 配列の最大要素数。0 の場合は制限しない
+	maxString   int            // 文字列の最大バイト数。0 の場合は制限しない
+}
+
+// オプション未指定時の設定値
+var defaultOptions = options{
+	location: time.UTC,
+}
+
+// オプションを適用した設定値を生成する
+func newOptions(opts []Option) *options {
+	var o = defaultOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &o
+}
+
+// 親ノードのオプション設定値を取得する。独自に実装されたノードの場合は、既定の設定値を返却する
+func optionsOf(p Node) *options {
+	if v, ok := p.(interface{ option() *options }); ok {
+		return v.option()
+	}
+	return &defaultOptions
+}
+
+// Location は、タイムゾーンの指定がない日付、時刻に使用するタイムゾーンを指定する。既定値は UTC
+func Location(loc *time.Location) Option {
+	return func(o *options) {
+		if loc != nil {
+			o.location = loc
+		}
+	}
+}
+
+// DecimalSize は、KB, MB, GB 等のサイズ単位を、10の累乗 (1MB = 1,000,000) として扱う。
+// 指定しない場合は、2の累乗 (1MB = 1,048,576) として扱う。KiB, MiB 等の単位は、常に2の累乗として扱う
+func DecimalSize() Option {
+	return func(o *options) {
+		o.decimalSize = true
+	}
+}
+
+// ExactNumbers は、整数、小数点を精度を落とさず json.Number として返却する。
+// 整数は桁数の制限がなくなり、config パッケージでは big.Int, big.Float, big.Rat 型のフィールドへ正確に格納できる
+func ExactNumbers() Option {
+	return func(o *options) {
+		o.exact = true
+	}
+}
+
+// UnicodeKeys は、引用符で囲まれていないキー名に、英数字以外の Unicode の文字、数字の使用を許可する。ex) 設定.名前 = "値"
+func UnicodeKeys() Option {
+	return func(o *options) {
+		o.unicodeKeys = true
+	}
+}
+
+// PreserveCase は、キー名を小文字へ変換せず、記述した通りに返却する。
+// キー名の重複は、大文字、小文字を区別せずに判定するため、App.Name と app.name は同じキーとして扱う
+func PreserveCase() Option {
+	return func(o *options) {
+		o.keyCase = keyPreserve
+	}
+}
+
+// CaseSensitive は、キー名を小文字へ変換せず、大文字、小文字を区別して扱う。App.Name と app.name は別のキーとなる
+func CaseSensitive() Option {
+	return func(o *options) {
+		o.keyCase = keyCaseSensitive
+	}
+}
+
+// LastWins は、キー名が重複した場合にエラーとせず、後から定義した値で上書きする。
+// 上書きされた定義は、Parser.Warnings で取得できる
+func LastWins() Option {
+	return func(o *options) {
+		o.duplicate = duplicateLastWins
+	}
+}
+
+// FirstWins は、キー名が重複した場合にエラーとせず、先に定義した値を使用する。
+// 無視された定義は、Parser.Warnings で取得できる
+func FirstWins() Option {
+	return func(o *options) {
+		o.duplicate = duplicateFirstWins
+	}
+}
+
+// MaxInputSize は、設定ファイルの最大バイト数を指定する。超えた場合はエラーとする。
+// 利用者がアップロードした設定ファイル等、信頼できない入力を解析する場合に指定する
+func MaxInputSize(n int) Option {
+	return func(o *options) {
+		o.maxInput = n
+	}
+}
+
+// MaxDepth は、キー名の階層 (a.b.c は3階層) と、配列の入れ子の最大の深さを指定する。超えた場合はエラーとする
+func MaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// MaxArrayLength は、1つの配列に指定できる最大の要素数を指定する。超えた場合はエラーとする
+func MaxArrayLength(n int) Option {
+	return func(o *options) {
+		o.maxArray = n
+	}
+}
+
+// MaxStringLength は、文字列の値の最大バイト数を指定する。エスケープシーケンスを展開した後の長さで判定し、超えた場合はエラーとする
+func MaxStringLength(n int) Option {
+	return func(o *options) {
+		o.maxString = n
+	}
+}
@@ -0,0 +1,68 @@
+package parser
+
+import "github.com/ochipin/config/internal/lookup"
+
+// 格納したキー名を、テーブル毎に定義された順序で記録する。paths は、p.paths で生成した各階層のキー名
+func (p *Parser) ordered(names, paths []string) {
+	if p.order == nil {
+		p.order = make(map[string][]string)
+	}
+	if p.seen == nil {
+		p.seen = make(map[string]bool)
+	}
+	data, _ := p.data.(map[string]interface{})
+	data, _ = data[p.mode].(map[string]interface{})
+	// 既存のキー名の表記に合わせながら、各テーブルのキー名を記録する
+	for i, name := range names {
+		name = lookup.Key(data, name, p.option().keyCase == keyPreserve)
+		if key := paths[i+1]; !p.seen[key] {
+			p.seen[key] = true
+			p.order[paths[i]] = append(p.order[paths[i]], name)
+		}
+		if data, _ = data[name].(map[string]interface{}); data == nil {
+			break
+		}
+	}
+}
+
+// [mode] で宣言されたモード名を、定義された順序で記録する。モード名は、キー名を持たない "mode\x00" として記録済みとする。
+// 全体設定領域の _all_ は、モード名に含めない
+func (p *Parser) addMode(mode string) {
+	if mode == "_all_" || p.seen[mode+"\x00"] {
+		return
+	}
+	if p.seen == nil {
+		p.seen = make(map[string]bool)
+	}
+	p.seen[mode+"\x00"] = true
+	p.modes = append(p.modes, mode)
+}
+
+// Modes は、[mode] で宣言されたモード名を、定義された順序で返却する。キーを持たないモード名も含み、_all_ は含まない
+func (p *Parser) Modes() []string {
+	return append([]string{}, p.modes...)
+}
+
+// Keys は、指定したモード名、キー名のテーブルが持つキー名を、設定ファイルで定義された順序で返却する。
+// ex) Keys("production", "http") ---> production モードの http.xxx のキー名一覧
+func (p *Parser) Keys(mode string, keys ...string) []string {
+	data, _ := p.data.(map[string]interface{})
+	data, _ = data[mode].(map[string]interface{})
+	var fold = p.option().keyCase == keyPreserve
+	// テーブルを辿りながら、既存のキー名の表記に合わせる
+	keys = append([]string{}, keys...)
+	for i, key := range keys {
+		keys[i] = lookup.Key(data, key, fold)
+		if data, _ = data[keys[i]].(map[string]interface{}); data == nil {
+			return nil
+		}
+	}
+	// 上書き等で削除されたキー名は除外する
+	var list []string
+	for _, key := range p.order[p.path(mode, keys)] {
+		if _, ok := data[key]; ok {
+			list = append(list, key)
+		}
+	}
+	return list
+}
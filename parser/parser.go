@@ -2,8 +2,11 @@ package parser
 
 import (
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Parser.stat, Parser.keep に設定する解析状態
@@ -27,15 +30,28 @@ const (
 	ParserMultiBeginString            // 複数行文字列の解析開始
 	ParserMultiEndString              // 複数行文字列の解析終了
 	ParserBeginArray                  // 配列解析
+	ParserNumberBin                   // 2進数
+	ParserNumberSpecial               // inf, nan
 )
 
 // Parser 構造体は、設定ファイルを解析する
 type Parser struct {
-	Value             // Value 構造体をミックスイン
-	data  interface{} // 保持するデータ
-	line  int         // 行番号
-	mode  string      // モード名
-	node  Node        // 値解析用ノード
+	Value                       // Value 構造体をミックスイン
+	data    interface{}         // 保持するデータ
+	line    int                 // 行番号
+	keys    []string            // "." 区切りで分割したキー名
+	quote   byte                // キー名の引用符の中を解析中の場合、引用符
+	mode    string              // モード名
+	prefix  []string            // [mode.prefix] で指定されたキー名の接頭辞
+	blocks  [][]string          // key { ... } で開いているブロックのキー名
+	closed  bool                // } の直後の場合 true。改行、;、コメントまでの間に、キー名は記述できない
+	headers map[string]bool     // 指定済みの [mode], [mode.prefix]
+	lines   map[string]int      // キー名を定義した行番号
+	warns   []Warning           // 重複して定義されたキー名の一覧
+	modes   []string            // 定義された順序のモード名
+	order   map[string][]string // 定義された順序の、テーブル毎のキー名
+	seen    map[string]bool     // order へ記録済みのキー名
+	node    Node                // 値解析用ノード
 }
 
 // Analyze 関数は、ダミー。解析時に使用する関数の引数に渡すためだけに実装している。
@@ -54,26 +70,23 @@ func (p *Parser) clear() {
 func (p *Parser) parse(b byte) (err error) {
 	// 値を解析する場合は、値解析用ノードを使用する
 	if p.node != nil {
-		// 現在の参照ポイントを設定
-		p.node.Cnt(p.cnt)
-		// 解析関数をコール
-		data, err := p.node.Analyze(b)
-		if err != nil {
-			return err
-		}
-		// 解析終了の場合、値をセットする
-		if p.node.Stat() == ParserNone {
-			p.stat = ParserNone
-			if err = Set(p.key, data, p.data, p.mode); err != nil {
+		// ブロック内の ; } は、改行と同様に値の終わりとして扱う
+		if len(p.blocks) == 0 || (b != ';' && b != '}') || !p.terminable() {
+			if err = p.analyze(b); err != nil {
 				return err
 			}
-			p.clear()
+			// 改行コードの場合、行番号をカウント
+			if b == '\n' {
+				p.line++
+			}
+			return nil
 		}
-		// 改行コードの場合、行番号をカウント
-		if b == '\n' {
-			p.line++
+		if err = p.analyze('\n'); err != nil {
+			return err
+		}
+		if p.node != nil {
+			return fmt.Errorf("\"%s\" setting value is invalid", p.key)
 		}
-		return nil
 	}
 
 	switch p.stat {
@@ -99,8 +112,46 @@ func (p *Parser) parse(b byte) (err error) {
 	return err
 }
 
+// 値解析用ノードで解析し、解析終了の場合は値をセットする
+func (p *Parser) analyze(b byte) error {
+	// 現在の参照ポイントを設定
+	p.node.Cnt(p.cnt)
+	// 解析関数をコール
+	data, err := p.node.Analyze(b)
+	if err != nil {
+		return err
+	}
+	// 解析終了の場合、値をセットする
+	if p.node.Stat() == ParserNone {
+		p.stat = ParserNone
+		if err = p.set(p.keys, data); err != nil {
+			return err
+		}
+		p.clear()
+	}
+	return nil
+}
+
+// ; } で値を終了できる解析状態か判定する
+func (p *Parser) terminable() bool {
+	if _, ok := p.node.(*Array); ok {
+		return false
+	}
+	return !inQuote(p.node) && !verbatim(p.node)
+}
+
 // 設定ファイル未解析状態の場合にコールされる
 func (p *Parser) none(b byte) (err error) {
+	// } の後は、空白、ブロックを閉じる } 以外に、改行、;、コメントのみ記述できる
+	if p.closed {
+		switch b {
+		case ' ', '}':
+		case '\n', ';', '#':
+			p.closed = false
+		default:
+			return fmt.Errorf("unexpected text after \"}\"")
+		}
+	}
 	switch b {
 	// コメント行の場合
 	case '#':
@@ -110,6 +161,9 @@ func (p *Parser) none(b byte) (err error) {
 		p.line++
 	// [modename]の始まりを解析する状態
 	case '[':
+		if len(p.blocks) > 0 {
+			return fmt.Errorf("mode name can not be specified in block")
+		}
 		p.stat = ParserModename
 		p.pos = p.cnt
 		p.end = 0
@@ -117,8 +171,28 @@ func (p *Parser) none(b byte) (err error) {
 	case '?', '!', '@', '$', '%', '^', '&', '*', '(', ')', '+', '|', '\\', ']':
 		return fmt.Errorf("key name specified is not special character")
 	// 未解析状態時では、使用できない特殊文字
-	case '`', '"', '-', '{', '}', ':', ';', '<', '>', '/', ',', '~', 39, '=':
+	case '`', '-', '{', ':', '<', '>', '/', ',', '~', '=':
 		return fmt.Errorf("key name specified is not special character")
+	// ブロック内では、; を区切り文字として扱う
+	case ';':
+		if len(p.blocks) == 0 {
+			return fmt.Errorf("key name specified is not special character")
+		}
+	// ブロックを閉じる
+	case '}':
+		if len(p.blocks) == 0 {
+			return fmt.Errorf("unexpected \"}\"")
+		}
+		p.blocks = p.blocks[:len(p.blocks)-1]
+		p.closed = true
+	// 引用符で囲まれたキー名の場合
+	case '"', 39:
+		if p.mode == "" {
+			return fmt.Errorf("mode name is empty")
+		}
+		p.stat = ParserKeyname
+		p.pos = p.cnt
+		p.quote = b
 	case ' ':
 	// key = value の key を解析する場合
 	default:
@@ -149,27 +223,40 @@ func (p *Parser) modename(b byte) (err error) {
 
 	// 先頭、最後尾の [] を外す
 	if p.mode != "" && p.mode[0] == '[' {
-		p.mode = strings.Trim(p.mode[1:], " ")
+		p.mode = trimSpace(p.mode[1:])
+	}
+	// [mode.prefix] の場合は、モード名と、以降のキー名に付与する接頭辞へ分割する
+	header := p.mode
+	p.prefix = nil
+	if i := strings.IndexByte(header, '.'); i != -1 {
+		prefix, ok := splitKey(header[i+1:], p.option())
+		if !ok {
+			return fmt.Errorf("\"%s\" mode name is invalid", header)
+		}
+		p.mode, p.prefix = trimSpace(header[:i]), prefix
+		header = p.mode + "." + joinKey(prefix)
 	}
 	// モード名が空文字列の場合、エラーとする
 	if p.mode == "" {
 		return fmt.Errorf("mode name is empty")
 	}
 	// モード名の値を検証する
-	if strings.Index(p.mode, " ") != -1 {
+	if hasSpace(p.mode) || strings.ContainsAny(p.mode, "\"'") {
 		return fmt.Errorf("\"%s\" mode name is invalid", p.mode)
 	}
-	if p.mode[0] == '_' {
+	// _ から始まるモード名は、全体設定領域を表す _all_ のみ指定できる
+	if p.mode[0] == '_' && p.mode != "_all_" {
 		return fmt.Errorf("\"%s\" can not specify '_' first character", p.mode)
 	}
 	// 既に使用済みのモード名の場合、エラーとする
-	if p.data != nil {
-		if v, ok := p.data.(map[string]interface{}); ok {
-			if _, ok := v[p.mode]; ok {
-				return fmt.Errorf("\"%s\" mode is already exists", p.mode)
-			}
-		}
+	if p.headers[header] {
+		return fmt.Errorf("\"%s\" mode is already exists", header)
+	}
+	if p.headers == nil {
+		p.headers = make(map[string]bool)
 	}
+	p.headers[header] = true
+	p.addMode(p.mode)
 	p.stat = ParserNone
 	return nil
 }
@@ -181,61 +268,75 @@ func (p *Parser) keyname(b byte) (err error) {
 	if b == '\n' {
 		return fmt.Errorf("invalid configuration")
 	}
-	// = が出現するまで左辺値として扱う
-	if b != '=' {
+	// 引用符で囲まれたキー名の中の = は、キー名の一部として扱う
+	switch {
+	case p.quote != 0:
+		if b == p.quote && (p.quote == 39 || !p.escaped()) {
+			p.quote = 0
+		}
+		return
+	case b == '"' || b == 39:
+		p.quote = b
+		return
+	}
+	// = または { が出現するまで左辺値として扱う
+	if b != '=' && b != '{' {
 		return
 	}
 	// = が出現した時点で、次回から右辺値を解析できるように準備する
 	p.stat = ParserValue
 	// 指定されたキーが、正しいかチェックする
-	p.key = strings.ToLower(strings.Trim(p.Param(), " "))
-	for _, v := range p.key {
-		if (v >= 'A' && v <= 'Z') || (v >= 'a' && v <= 'z') || (v >= '0' && v <= '9') || v == '.' || v == '_' {
-		} else {
-			return fmt.Errorf("\"%s\" key name is invalid", p.key)
+	keys, ok := splitKey(p.Param(), p.option())
+	if !ok {
+		p.key = trimSpace(p.Param())
+		if p.option().keyCase == keyLower {
+			p.key = strings.ToLower(p.key)
 		}
-	}
-	// 先頭、最後尾に "." があった場合は、不正なキー名として扱う
-	if p.key != "" && p.key[0] == '.' || p.key[len(p.key)-1] == '.' || p.key[0] == '_' || p.key[len(p.key)-1] == '_' {
 		return fmt.Errorf("\"%s\" key name is invalid", p.key)
 	}
-	// "."区切りのキー名の先頭が、数字の場合は不正なキー名として扱う
-	for _, keyname := range strings.Split(p.key, ".") {
-		if keyname[0] >= '0' && keyname[0] <= '9' || keyname[0] == '_' || keyname[len(keyname)-1] == '_' {
-			return fmt.Errorf("\"%s\" key name is invalid", p.key)
-		}
+	// [mode.prefix] や key { ... } が指定されている場合は、接頭辞を付与する
+	p.keys = append([]string{}, p.prefix...)
+	for _, block := range p.blocks {
+		p.keys = append(p.keys, block...)
+	}
+	p.keys = append(p.keys, keys...)
+	p.key = joinKey(p.keys)
+	if err := p.limitDepth(len(p.keys)); err != nil {
+		return err
+	}
+	// { の場合は、ブロックを開く
+	if b == '{' {
+		p.stat = ParserNone
+		p.blocks = append(p.blocks, keys)
 	}
 	// 開始、終了の範囲をクリアする
 	p.clear()
 	return
 }
 
+// 現在の文字が、\ でエスケープされているか判定する
+func (p *Parser) escaped() bool {
+	var n int
+	for p.cnt-n-1 >= p.pos && p.Text()[p.cnt-n-1] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
+
 // 右辺値(value)を解析する
 func (p *Parser) value(b byte) error {
-	switch b {
-	// 小数点、日付、10/8/16進数のいずれかの場合
-	case '0', '+', '-', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		p.pos = p.cnt
-		p.end = p.cnt + 1
-		p.node = NewNumber(p)
-	// 真偽値
-	case 't', 'f':
-		p.pos = p.cnt
-		p.end = p.cnt + 1
-		p.node = NewBoolean(p)
-	// 文字列
-	case '"', 39:
-		p.pos = p.cnt
-		p.end = p.cnt + 1
-		p.node = NewString(p)
-	// 環境変数
-	case '$':
+	// 値の先頭の文字から、値解析用ノードを生成する
+	if b != ' ' && b != '\n' {
 		p.pos = p.cnt
 		p.end = p.cnt + 1
-		p.node = NewEnviron(p)
+		if node := newNode(p, b); node != nil {
+			p.node = node
+			return nil
+		}
+	}
+	switch b {
 	// 配列
 	case '[':
-		// p.stat = ParserBeginArray
 		p.pos = p.cnt + 1
 		p.node = NewArray(p)
 	// 空白は無視
@@ -246,54 +347,214 @@ func (p *Parser) value(b byte) error {
 	return nil
 }
 
+// 行末の \ による行継続の場合、読み飛ばすバイト数を返却する。継続する行の先頭の空白も読み飛ばす
+func (p *Parser) continuation(i int) int {
+	text := p.Text()
+	if text[i] != '\\' || i+1 >= len(text) || text[i+1] != '\n' {
+		return 0
+	}
+	// \\ のように、エスケープされた \ の場合は対象外とする
+	var n int
+	for i-n >= 0 && text[i-n] == '\\' {
+		n++
+	}
+	if n%2 == 0 {
+		return 0
+	}
+	// 値の解析中のみ行継続を認める。コメント、複数行文字列、raw 文字列の中は対象外とする
+	if p.node == nil && p.stat != ParserValue || p.node != nil && verbatim(p.node) {
+		return 0
+	}
+	n = 2
+	for i+n < len(text) && (text[i+n] == ' ' || text[i+n] == '\t') {
+		n++
+	}
+	p.line++
+	return n
+}
+
+// 半角空白として扱う空白文字の場合、空白文字のバイト数を返却する。文字列の引用符の中は対象外とする
+func (p *Parser) space(i int) int {
+	text := p.Text()
+	c := text[i]
+	if c == ' ' || c == '\n' || (c < utf8.RuneSelf && !unicode.IsSpace(rune(c))) {
+		return 0
+	}
+	r, size := utf8.DecodeRune(text[i:])
+	if !isSpace(r) || p.node != nil && inQuote(p.node) {
+		return 0
+	}
+	return size
+}
+
+// 文字列の引用符の中を解析中か判定する。独自に実装されたノードの場合は、文字をそのまま渡す
+func inQuote(node Node) bool {
+	switch n := node.(type) {
+	case *Array:
+		n = n.inner()
+		return n.node != nil && inQuote(n.node)
+	case *Literal:
+		return n.node != nil && inQuote(n.node)
+	case *String:
+		return n.stat == ParserBeginString || n.stat == ParserMultiBeginString
+	case *Number, *Boolean, *Environ, *Network:
+		return false
+	}
+	return true
+}
+
+// 行継続を認めない解析状態か判定する
+func verbatim(node Node) bool {
+	switch n := node.(type) {
+	case *Array:
+		n = n.inner()
+		if n.node != nil {
+			return verbatim(n.node)
+		}
+		node = n
+	case *Literal:
+		if n.node != nil {
+			return verbatim(n.node)
+		}
+	case *String:
+		if n.quote == '`' {
+			return true
+		}
+	}
+	switch node.Stat() {
+	case ParserComment, ParserMultiBeginString:
+		return true
+	}
+	return false
+}
+
 // Data は、整形した map[string]interface{} 型を返却する
 func (p *Parser) Data() interface{} {
 	return p.data
 }
 
 // Parse は、設定ファイル情報から map[string]interface{} 情報を構築する
-func parse(buf []byte, mode string) (*Parser, error) {
-	// CR+LF, CR 対策
-	s := strings.Replace(string(buf), "\r\n", "\n", -1)
-	s = strings.Replace(s, "\r", "\n", -1) + "\n"
+func parse(src *source, mode string, o *options) (*Parser, error) {
 	// パース構造体を生成
 	var parser = &Parser{
 		Value: Value{
-			text: []byte(s),
+			src:  src,
 			stat: ParserNone,
+			opts: o,
 		},
 		data: make(map[string]interface{}),
 		mode: mode,
 	}
 
 	// パース処理開始
-	for i := 0; i < len(parser.text); i++ {
-		c := parser.text[i]
+	for i := 0; ; i++ {
+		// io.Reader から解析する場合は、必要な分だけ読み込み、解析済みの行を破棄する
+		var err error
+		if i, err = parser.fill(i); err != nil {
+			return nil, err
+		}
+		if i >= len(src.text) {
+			break
+		}
+		// 行末の \ は、次の行へ値を継続する
+		if n := parser.continuation(i); n > 0 {
+			i += n - 1
+			continue
+		}
+		// タブ、Unicode の空白は、文字列の値以外では半角空白として扱う
+		c, n := src.text[i], 1
+		if size := parser.space(i); size > 0 {
+			c, n = ' ', size
+		}
 		// パースする
-		parser.cnt = i
-		if err := parser.parse(c); err != nil {
-			if e, ok := err.(*strconv.NumError); ok {
-				return nil, fmt.Errorf("parsing error:%d: \"%s\" setting value is \"%s\" %s", parser.line+1, parser.key, e.Num, e.Err)
+		for j := 0; j < n; j++ {
+			parser.cnt = i + j
+			if err := parser.parse(c); err != nil {
+				return nil, parser.error(err)
 			}
-			return nil, fmt.Errorf("syntax error:%d: %s", parser.line+1, err)
 		}
+		i += n - 1
 	}
 
 	// 正しく解析終了したかチェックする
 	if parser.stat != ParserNone {
 		return nil, fmt.Errorf("syntax error: invalid configuration. probably cause \"%s\" parameters", parser.key)
 	}
+	if len(parser.blocks) > 0 {
+		var keys []string
+		for _, block := range parser.blocks {
+			keys = append(keys, block...)
+		}
+		return nil, fmt.Errorf("syntax error: \"%s\" block is not closed", joinKey(keys))
+	}
 	parser.mode = ""
 
 	return parser, nil
 }
 
+// 解析エラーに、行番号を付与する
+func (p *Parser) error(err error) error {
+	if e, ok := err.(*strconv.NumError); ok {
+		return fmt.Errorf("parsing error:%d: \"%s\" setting value is \"%s\" %s", p.line+1, p.key, e.Num, e.Err)
+	}
+	// 位置情報を持つエラーの場合は、行番号と桁番号を表示する
+	if e, ok := err.(*positionError); ok {
+		line, col := position(p.Text(), e.offset)
+		return fmt.Errorf("syntax error:%d:%d: %s", line+p.src.line, col, e)
+	}
+	return fmt.Errorf("syntax error:%d: %s", p.line+1, err)
+}
+
 // Parse は、冒頭にモード指定がされていなくとも設定ファイルを解析する
-func Parse(buf []byte) (*Parser, error) {
-	return parse(buf, "_all_")
+func Parse(buf []byte, opts ...Option) (*Parser, error) {
+	// 上限を超える場合は、変換、検証を行う前にエラーとする
+	o := newOptions(opts)
+	if err := o.limitSize(len(buf)); err != nil {
+		return nil, err
+	}
+	src, err := newSource(buf)
+	if err != nil {
+		return nil, err
+	}
+	return parse(src, "_all_", o)
 }
 
 // ParseModeAll は、冒頭にモード指定がされていないと設定ファイルを解析しない
-func ParseModeAll(buf []byte) (*Parser, error) {
-	return parse(buf, "")
+func ParseModeAll(buf []byte, opts ...Option) (*Parser, error) {
+	// 上限を超える場合は、変換、検証を行う前にエラーとする
+	o := newOptions(opts)
+	if err := o.limitSize(len(buf)); err != nil {
+		return nil, err
+	}
+	src, err := newSource(buf)
+	if err != nil {
+		return nil, err
+	}
+	return parse(src, "", o)
+}
+
+// ParseReader は、r から設定ファイルを一定のサイズ毎に読み込みながら解析する。
+// 解析済みの行は破棄するため、巨大な設定ファイルでも、ファイル全体を保持せずに解析できる
+func ParseReader(r io.Reader, opts ...Option) (*Parser, error) {
+	return parse(newReaderSource(r), "_all_", newOptions(opts))
+}
+
+// ParseModeAllReader は、ParseReader と同様に解析する。冒頭にモード指定がされていないと設定ファイルを解析しない
+func ParseModeAllReader(r io.Reader, opts ...Option) (*Parser, error) {
+	return parse(newReaderSource(r), "", newOptions(opts))
+}
+
+// ParseValue は、設定ファイルの右辺値と同じ書式で記述された値を解析する。
+// 改行等で、値以外のキーやモードを定義している場合はエラーとする
+func ParseValue(s string, opts ...Option) (interface{}, error) {
+	p, err := Parse([]byte("value = "+s), opts...)
+	if err != nil {
+		return nil, err
+	}
+	data := p.data.(map[string]interface{})
+	all, _ := data["_all_"].(map[string]interface{})
+	if len(data) != 1 || len(all) != 1 || len(p.modes) != 0 {
+		return nil, fmt.Errorf("syntax error: %q is not a single value", s)
+	}
+	return all["value"], nil
 }
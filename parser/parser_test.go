@@ -1,9 +1,20 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 // Parse 関数の正常系テスト
@@ -110,7 +121,8 @@ func TestNormalParseCase(t *testing.T) {
 		"arrays.number1 = [0, 1, 0644, 0xFF, 200, 100] # array integer",
 		"arrays.number2 = [100, 200] # array integer",
 		"arrays.float1 = [3.1,4.2, 4.3]",
-		"arrays.int64  = [100s, 1d, 100KB, 1TB]",
+		"arrays.int64  = [100KB, 1TB]",
+		"arrays.duration = [100s, 1d, 1h30m, 1.5ms]",
 		"arrays.datetime = [",
 		"  2017-01-01 00:00:00, 2017-02-01 01:00:00,",
 		"  2017-03-01 03:00:00, 2017-04-01 04:00:00,",
@@ -244,16 +256,16 @@ func TestErrorDuplicateCase(t *testing.T) {
 // 数字系の異常系テスト
 func TestErrorIntegerCase(t *testing.T) {
 	// オーバーフロー
-	if _, err := Parse([]byte("integer = 2147483648")); err == nil {
+	if _, err := Parse([]byte("integer = 18446744073709551616")); err == nil {
 		t.Error("overflow test failed")
 	}
-	if _, err := Parse([]byte("integer = 2,147,483,648")); err == nil {
+	if _, err := Parse([]byte("integer = 18,446,744,073,709,551,616")); err == nil {
 		t.Error("overflow test failed")
 	}
-	if _, err := Parse([]byte("integer = 0x100000000")); err == nil {
+	if _, err := Parse([]byte("integer = 0x1_0000_0000_0000_0000")); err == nil {
 		t.Error("overflow test failed")
 	}
-	if _, err := Parse([]byte("integer = 070000000000000")); err == nil {
+	if _, err := Parse([]byte("integer = 02000000000000000000000")); err == nil {
 		t.Error("overflow test failed")
 	}
 	if _, err := Parse([]byte("integer = 1000000000000000000000000000000000000000d")); err == nil {
@@ -262,7 +274,7 @@ func TestErrorIntegerCase(t *testing.T) {
 	if _, err := Parse([]byte("integer = 1000000000000000000000000000000000000000TB")); err == nil {
 		t.Error("overflow test failed")
 	}
-	if _, err := Parse([]byte("float = 1000000000000000000000000000000000000000.2987654321")); err == nil {
+	if _, err := Parse([]byte("float = " + strings.Repeat("9", 310) + ".2987654321")); err == nil {
 		t.Error("overflow test failed")
 	}
 	// 数字以外の入力はエラー
@@ -407,7 +419,1451 @@ func TestErrorArrayCase(t *testing.T) {
 	if _, err := Parse([]byte("array = [Hello World]")); err == nil {
 		t.Error("array = ng")
 	}
-	if _, err := Parse([]byte("array = [2147483648]")); err == nil {
+	if _, err := Parse([]byte("array = [18446744073709551616]")); err == nil {
 		t.Error("array = ng")
 	}
 }
+
+// テスト用の独自ノード。/pattern/ 形式の正規表現を解析する
+type regexpNode struct {
+	Value
+	array bool
+}
+
+func newRegexpNode(p Node) Node {
+	_, ok := p.(*Array)
+	node := &regexpNode{Value: NewValue(p), array: ok}
+	return node
+}
+
+func (node *regexpNode) Analyze(b byte) (interface{}, error) {
+	param := node.Param()
+	if b == '\n' || (node.array && (b == ',' || b == ']')) {
+		if len(param) < 2 || param[len(param)-1] != '/' {
+			return nil, fmt.Errorf("\"%s\" regexp invalid value", node.Keyname())
+		}
+		node.SetStat(ParserNone)
+		return regexp.Compile(param[1 : len(param)-1])
+	}
+	node.SetEnd(node.Getidx() + 1)
+	return nil, nil
+}
+
+// 登録したノード、タグ付き文字列を削除する。他のテストは、組み込みの値のみで解析する
+func resetRegistry() {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.prefixes = nil
+	registry.nodes = make(map[string]NodeFunc)
+	registry.literals = make(map[string]LiteralFunc)
+}
+
+// 独自に登録したノード、タグ付き文字列のテスト
+func TestRegisteredNodeCase(t *testing.T) {
+	RegisterNode("/", newRegexpNode)
+	RegisterLiteral("hex", func(s string) (interface{}, error) {
+		return hex.DecodeString(s)
+	})
+	t.Cleanup(resetRegistry)
+
+	var strs = []string{
+		"pattern  = /^[a-z]+$/",
+		"patterns = [/^a/, /^b/]",
+		"hash     = hex\"0a0b\" # comment",
+		"hashes   = [hex'01', hex\"02\"]",
+		"bool     = true",
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	if re, ok := data["pattern"].(*regexp.Regexp); !ok || !re.MatchString("abc") {
+		t.Fatal("registered node test failed", data["pattern"])
+	}
+	if res, ok := data["patterns"].([]*regexp.Regexp); !ok || len(res) != 2 || !res[1].MatchString("b") {
+		t.Fatal("registered node test failed", data["patterns"])
+	}
+	if fmt.Sprint(data["hash"]) != "[10 11]" || fmt.Sprint(data["hashes"]) != "[[1] [2]]" {
+		t.Fatal("registered literal test failed", data["hash"], data["hashes"])
+	}
+	if data["bool"] != true {
+		t.Fatal("registered literal test failed", data["bool"])
+	}
+
+	// 変換に失敗した場合はエラーとする
+	if _, err := Parse([]byte(`hash = hex"zz"`)); err == nil {
+		t.Error("hash = ng")
+	}
+	if _, err := Parse([]byte(`hash = [hex"01" hex"02"]`)); err == nil {
+		t.Error("hash = ng")
+	}
+	if _, err := Parse([]byte(`pattern = /abc`)); err == nil {
+		t.Error("pattern = ng")
+	}
+	// 未登録のタグ名はエラーとする
+	if _, err := Parse([]byte(`hash = base64"AA=="`)); err == nil {
+		t.Error("hash = ng")
+	}
+}
+
+// IPアドレス、CIDR、ホスト名:ポート番号の正常系テスト
+func TestNormalNetworkCase(t *testing.T) {
+	var strs = []string{
+		"ipv4   = 192.168.0.1 # comment",
+		"ipv6   = fe80::1",
+		"loop   = ::1",
+		"cidr4  = 10.0.0.1/8",
+		"cidr6  = 2001:db8::/32",
+		"listen = :8080",
+		"host   = localhost:80",
+		"addr   = [::1]:443",
+		"allow  = [10.0.0.0/8, 172.16.0.0/12,",
+		"          192.168.0.0/16]",
+		"ips    = [127.0.0.1, ::1]",
+		"hosts  = [[::1]:80, example.com:443]",
+		"zone   = fe80::1%eth0",
+		"zones  = [[fe80::1%eth0]:80, [fe80::2%1]:443]",
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	var tests = map[string]string{
+		"ipv4":   "192.168.0.1",
+		"ipv6":   "fe80::1",
+		"loop":   "::1",
+		"cidr4":  "10.0.0.0/8",
+		"cidr6":  "2001:db8::/32",
+		"listen": ":8080",
+		"host":   "localhost:80",
+		"addr":   "[::1]:443",
+		"allow":  "[10.0.0.0/8 172.16.0.0/12 192.168.0.0/16]",
+		"ips":    "[127.0.0.1 ::1]",
+		"hosts":  "[[::1]:80 example.com:443]",
+		"zone":   "fe80::1%eth0",
+		"zones":  "[[fe80::1%eth0]:80 [fe80::2%1]:443]",
+	}
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %v != %s", key, data[key], value)
+		}
+	}
+	if _, ok := data["ipv4"].(net.IP); !ok {
+		t.Error("ipv4 is not net.IP")
+	}
+	if _, ok := data["cidr4"].(*net.IPNet); !ok {
+		t.Error("cidr4 is not *net.IPNet")
+	}
+	if _, ok := data["zone"].(string); !ok {
+		t.Error("zone is not string")
+	}
+}
+
+// IPアドレス、CIDR、ホスト名:ポート番号の異常系テスト
+func TestErrorNetworkCase(t *testing.T) {
+	if _, err := Parse([]byte("ip = 192.168.0.1 8080")); err == nil {
+		t.Error("ip = ng")
+	}
+	if _, err := Parse([]byte("ip = 192.168.0.256")); err == nil {
+		t.Error("ip = ng")
+	}
+	if _, err := Parse([]byte("cidr = 10.0.0.0/33")); err == nil {
+		t.Error("cidr = ng")
+	}
+	if _, err := Parse([]byte("host = localhost:65536")); err == nil {
+		t.Error("host = ng")
+	}
+	if _, err := Parse([]byte("host = localhost")); err == nil {
+		t.Error("host = ng")
+	}
+	if _, err := Parse([]byte("ips = [127.0.0.1 ::1]")); err == nil {
+		t.Error("ips = ng")
+	}
+	if _, err := Parse([]byte("ips = [127.0.0.1, 10.0.0.0/8]")); err == nil {
+		t.Error("ips = ng")
+	}
+	// ポート番号が範囲外の場合
+	var errors = map[string]string{
+		"a = [::1]:99999":         `syntax error:1: "a = [::1]:99999" port number invalid value`,
+		"a = localhost:65536":     `syntax error:1: "a = localhost:65536" port number invalid value`,
+		"a = 127.0.0.1:70000":     `syntax error:1: "a = 127.0.0.1:70000" port number invalid value`,
+		"a = [[::1]:80, :800000]": `syntax error:1: "a = :800000" port number invalid value`,
+		"a = [fe80::1%lo]:70000":  `syntax error:1: "a = [fe80::1%lo]:70000" port number invalid value`,
+	}
+	for test, msg := range errors {
+		if _, err := Parse([]byte(test)); err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+	// ゾーンが誤っている場合
+	for _, test := range []string{"a = fe80::1%", "a = 192.168.0.1%eth0", "a = fe80::1%eth0%1", "a = fe80::1%eth0/64"} {
+		msg := fmt.Sprintf("syntax error:1: %q network address invalid value", test)
+		if _, err := Parse([]byte(test)); err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+}
+
+// 日付、時刻の正常系テスト
+func TestNormalDatetimeCase(t *testing.T) {
+	var strs = []string{
+		"datetime1 = 2018-03-10 14:32:11",
+		"datetime2 = 2018-03-10T14:32:11+09:00 # comment",
+		"datetime3 = 2018-03-10T14:32:11.125Z",
+		"datetime4 = 2018-03-10 14:32:11.5-05:30",
+		"date      = 2018-03-10",
+		"time1     = 09:30:00",
+		"time2     = 23:59:59.999",
+		"dates     = [2018-03-10, 2018-03-11T00:00:00Z]",
+		"times     = [09:30:00, 10:00:00]",
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	var tests = map[string]string{
+		"datetime1": "2018-03-10 14:32:11 +0000 UTC",
+		"datetime2": "2018-03-10 14:32:11 +0900 +0900",
+		"datetime3": "2018-03-10 14:32:11.125 +0000 UTC",
+		"datetime4": "2018-03-10 14:32:11.5 -0530 -0530",
+		"date":      "2018-03-10 00:00:00 +0000 UTC",
+		"time1":     "0000-01-01 09:30:00 +0000 UTC",
+		"time2":     "0000-01-01 23:59:59.999 +0000 UTC",
+		"dates":     "[2018-03-10 00:00:00 +0000 UTC 2018-03-11 00:00:00 +0000 UTC]",
+		"times":     "[0000-01-01 09:30:00 +0000 UTC 0000-01-01 10:00:00 +0000 UTC]",
+	}
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %v != %s", key, data[key], value)
+		}
+	}
+
+	// タイムゾーンの指定がない場合は、Location オプションで指定したタイムゾーンを使用する
+	jst := time.FixedZone("JST", 9*60*60)
+	p, err = Parse([]byte(strings.Join(strs, "\n")), Location(jst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	if fmt.Sprint(data["datetime1"]) != "2018-03-10 14:32:11 +0900 JST" {
+		t.Error("location test failed", data["datetime1"])
+	}
+	if fmt.Sprint(data["datetime3"]) != "2018-03-10 14:32:11.125 +0000 UTC" {
+		t.Error("location test failed", data["datetime3"])
+	}
+	if fmt.Sprint(data["time1"]) != "0000-01-01 09:30:00 +0900 JST" {
+		t.Error("location test failed", data["time1"])
+	}
+
+	// 不正な日付、時刻
+	if _, err := Parse([]byte("date = 2018-03-10T")); err == nil {
+		t.Error("date = ng")
+	}
+	if _, err := Parse([]byte("date = 2018-03-10 14:32:11+9")); err == nil {
+		t.Error("date = ng")
+	}
+	if _, err := Parse([]byte("time = 25:00:00")); err == nil {
+		t.Error("time = ng")
+	}
+	if _, err := Parse([]byte("time = 09:30")); err == nil {
+		t.Error("time = ng")
+	}
+}
+
+// 時間表記の正常系テスト
+func TestNormalDurationCase(t *testing.T) {
+	var strs = []string{
+		"duration1  = 1h30m",
+		"duration2  = 2d12h # comment",
+		"duration3  = 1m30s500ms",
+		"duration4  = 1.5s",
+		"duration5  = 100us",
+		"duration6  = 100µs",
+		"duration7  = 10ns",
+		"duration8  = 2w",
+		"duration9  = -1,500ms",
+		"duration10 = 0.5h",
+		"durations  = [1h30m, 1.5s, 10ns]",
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	var tests = map[string]string{
+		"duration1":  "1h30m0s",
+		"duration2":  "60h0m0s",
+		"duration3":  "1m30.5s",
+		"duration4":  "1.5s",
+		"duration5":  "100µs",
+		"duration6":  "100µs",
+		"duration7":  "10ns",
+		"duration8":  "336h0m0s",
+		"duration9":  "-1.5s",
+		"duration10": "30m0s",
+		"durations":  "[1h30m0s 1.5s 10ns]",
+	}
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %v != %s", key, data[key], value)
+		}
+	}
+}
+
+// 時間表記の異常系テスト
+func TestErrorDurationCase(t *testing.T) {
+	var tests = []string{
+		"duration = 1h30",
+		"duration = 1hh",
+		"duration = 1.s",
+		"duration = 1..5s",
+		"duration = 1h 30m",
+		"duration = 1x",
+		"duration = 1,s",
+		"duration = 106752d",
+		"duration = 15251w",
+		"duration = 9223372036s1s",
+		"duration = 99999999999999999999999ns",
+	}
+	for _, test := range tests {
+		if _, err := Parse([]byte(test)); err == nil {
+			t.Error(test)
+		}
+	}
+}
+
+// サイズ表記の正常系テスト
+func TestNormalSizeCase(t *testing.T) {
+	var strs = []string{
+		"size1  = 1kB",
+		"size2  = 1KB",
+		"size3  = 1KiB",
+		"size4  = 1.5GB # comment",
+		"size5  = 1.5GiB",
+		"size6  = 2PB",
+		"size7  = 1EiB",
+		"size8  = 0.5MiB",
+		"size9  = 1,000MB",
+		"sizes  = [1KiB, 1.5MB, 10B]",
+	}
+	var tests = []map[string]string{
+		{
+			"size1": "1000",
+			"size2": "1024",
+			"size3": "1024",
+			"size4": "1610612736",
+			"size5": "1610612736",
+			"size6": "2251799813685248",
+			"size7": "1152921504606846976",
+			"size8": "524288",
+			"size9": "1048576000",
+			"sizes": "[1024 1572864 10]",
+		},
+		// DecimalSize オプション指定時は、KB, MB 等を10の累乗として扱う
+		{
+			"size1": "1000",
+			"size2": "1000",
+			"size3": "1024",
+			"size4": "1500000000",
+			"size5": "1610612736",
+			"size6": "2000000000000000",
+			"size7": "1152921504606846976",
+			"size8": "524288",
+			"size9": "1000000000",
+			"sizes": "[1024 1500000 10]",
+		},
+	}
+	for i, opts := range [][]Option{nil, {DecimalSize()}} {
+		p, err := Parse([]byte(strings.Join(strs, "\n")), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+		for key, value := range tests[i] {
+			if fmt.Sprint(data[key]) != value {
+				t.Errorf("%d: %s: %v != %s", i, key, data[key], value)
+			}
+		}
+	}
+}
+
+// サイズ表記の異常系テスト
+func TestErrorSizeCase(t *testing.T) {
+	var tests = []string{
+		"size = 1.5B",
+		"size = 1KiKB",
+		"size = 1Ki",
+		"size = 1kiB",
+		"size = 1.KB",
+		"size = 1.5.5KB",
+		"size = 8EiB",
+		"size = 7.9999999999999999999EiB",
+		"size = 10000PB",
+	}
+	for _, test := range tests {
+		if _, err := Parse([]byte(test)); err == nil {
+			t.Error(test)
+		}
+	}
+	// 負のサイズ、1バイト未満の端数が出るサイズはエラーとする
+	var errors = map[string]string{
+		"size = -1KB":              `syntax error:1: "size = -1KB" size can not be negative`,
+		"size = -1.5MiB":           `syntax error:1: "size = -1.5MiB" size can not be negative`,
+		"sizes = [1KB, -2KB]":      `syntax error:1: "sizes = -2KB" size can not be negative`,
+		"size = 0.1KB":             `syntax error:1: "size = 0.1KB" size is not a whole number of bytes`,
+		"size = 0.0001kB":          `syntax error:1: "size = 0.0001kB" size is not a whole number of bytes`,
+		"sizes = [1.5KiB, 1.1KiB]": `syntax error:1: "sizes = 1.1KiB" size is not a whole number of bytes`,
+	}
+	for test, msg := range errors {
+		if _, err := Parse([]byte(test)); err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+	// 端数が出ない場合は、小数点以下の桁数に関わらず格納する
+	p, err := Parse([]byte("a = 0.001kB\nb = 0.25KiB\nc = 1.000000000000000001EB"), DecimalSize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := fmt.Sprint(p.Data()); v != "map[_all_:map[a:1 b:256 c:1000000000000000001]]" {
+		t.Error(v)
+	}
+}
+
+// 64bit 整数、小数点、2進数、区切り文字、inf/nan の正常系テスト
+func TestNormalNumericCase(t *testing.T) {
+	var strs = []string{
+		"int1    = 2147483648",
+		"int2    = -9223372036854775808",
+		"int3    = 18446744073709551615",
+		"int4    = 1_000_000",
+		"int5    = 0b1010 # comment",
+		"int6    = 0xFFFF_FFFF_FFFF",
+		"int7    = 07_55",
+		"float1  = 3.141592653589793",
+		"float2  = -1_000.000_5",
+		"float3  = inf",
+		"float4  = -inf",
+		"float5  = nan",
+		"floats  = [1.5, +inf, 0.25]",
+		"ints    = [0b11, 1_024, 0x10]",
+		"uints   = [1, 18446744073709551615, 0x10]",
+		"int64s  = [-1, 9223372036854775807]",
+	}
+	// 配列内の整数は、全ての値を格納できる型へ揃える。32bit 環境では int の範囲を超えるため int64 とする
+	var int64s = "[]int64 [-1 9223372036854775807]"
+	if math.MaxInt == math.MaxInt64 {
+		int64s = "[]int [-1 9223372036854775807]"
+	}
+	var tests = []map[string]string{
+		{
+			"int1":   "int 2147483648",
+			"int2":   "int -9223372036854775808",
+			"int3":   "uint64 18446744073709551615",
+			"int4":   "int 1000000",
+			"int5":   "int 10",
+			"int6":   "int 281474976710655",
+			"int7":   "int 493",
+			"float1": "float64 3.141592653589793",
+			"float2": "float64 -1000.0005",
+			"float3": "float64 +Inf",
+			"float4": "float64 -Inf",
+			"float5": "float64 NaN",
+			"floats": "[]float64 [1.5 +Inf 0.25]",
+			"ints":   "[]int [3 1024 16]",
+			"uints":  "[]uint64 [1 18446744073709551615 16]",
+			"int64s": int64s,
+		},
+		// ExactNumbers オプション指定時は、json.Number として扱う
+		{
+			"int1":   "json.Number 2147483648",
+			"int2":   "json.Number -9223372036854775808",
+			"int3":   "json.Number 18446744073709551615",
+			"int4":   "json.Number 1000000",
+			"int5":   "json.Number 10",
+			"int6":   "json.Number 281474976710655",
+			"int7":   "json.Number 493",
+			"float1": "json.Number 3.141592653589793",
+			"float2": "json.Number -1000.0005",
+			"float3": "json.Number +Inf",
+			"float4": "json.Number -Inf",
+			"float5": "json.Number NaN",
+			"floats": "[]json.Number [1.5 +Inf 0.25]",
+			"ints":   "[]json.Number [3 1024 16]",
+			"uints":  "[]json.Number [1 18446744073709551615 16]",
+			"int64s": "[]json.Number [-1 9223372036854775807]",
+		},
+	}
+	for i, opts := range [][]Option{nil, {ExactNumbers()}} {
+		p, err := Parse([]byte(strings.Join(strs, "\n")), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+		for key, value := range tests[i] {
+			if s := fmt.Sprintf("%T %v", data[key], data[key]); s != value {
+				t.Errorf("%d: %s: %s != %s", i, key, s, value)
+			}
+		}
+	}
+
+	// ExactNumbers オプション指定時は、桁数の制限がない
+	p, err := Parse([]byte("int = 123456789012345678901234567890"), ExactNumbers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})["int"]; v != json.Number("123456789012345678901234567890") {
+		t.Errorf("exact: %v", v)
+	}
+}
+
+// 64bit 整数、小数点、2進数、区切り文字、inf/nan の異常系テスト
+func TestErrorNumericCase(t *testing.T) {
+	var tests = []string{
+		"int = -9223372036854775809",
+		"int = 0b102",
+		"int = 0b",
+		"int = 0x",
+		"int = 1__000",
+		"int = 1_000_",
+		"int = 1_,000",
+		"int = 0x_FF",
+		"int = +_1",
+		"float = 1_.5",
+		"float = 1._5",
+		"float = infinity",
+		"float = nan1",
+		"float = inf inf",
+		"float = +nan",
+		"array = [1, inf, 2]",
+	}
+	for _, test := range tests {
+		if _, err := Parse([]byte(test)); err == nil {
+			t.Error(test)
+		}
+	}
+	// 符号付きの nan は、float の誤りとする
+	var errors = map[string]string{
+		"ints = [-1, 18446744073709551615]": `syntax error:1: "ints" array of integers out of range`,
+		"ints = [18446744073709551615, -1]": `syntax error:1: "ints" array of integers out of range`,
+		"ints = [1, 1.5]":                   `syntax error:1: "ints" array of different types are confused`,
+		"float = +nan":                      `syntax error:1: "float = +nan" float invalid value`,
+		"float = -nan":                      `syntax error:1: "float = -nan" float invalid value`,
+		"floats = [1.5, -nan]":              `syntax error:1: "floats = -nan" float invalid value`,
+		"floats = [+nan, -inf]":             `syntax error:1: "floats = +nan" float invalid value`,
+	}
+	for test, msg := range errors {
+		if _, err := Parse([]byte(test)); err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+}
+
+// エスケープシーケンスの正常系テスト
+func TestNormalEscapeCase(t *testing.T) {
+	var strs = []string{
+		`str1 = "a\tb\r\n\0"`,
+		`str2 = "\x41\x7f"`,
+		`str3 = "\u3042\U0001F600"`,
+		`str4 = "C:\\path\\"`,
+		`str5 = "say \"hi\""`,
+		`strs = ["\u00e9", "\\"]`,
+		`str6 = """`,
+		`\u3044\n"""`,
+		`str7 = 'a\nb'`,
+	}
+	var tests = map[string]string{
+		"str1": "a\tb\r\n\x00",
+		"str2": "A\x7f",
+		"str3": "あ😀",
+		"str4": `C:\path\`,
+		"str5": `say "hi"`,
+		"strs": `[é \]`,
+		"str6": "い\n",
+		"str7": `a\nb`,
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %q != %q", key, data[key], value)
+		}
+	}
+}
+
+// エスケープシーケンスの異常系テスト
+func TestErrorEscapeCase(t *testing.T) {
+	var tests = map[string]string{
+		`str = "abc\q"`:                    `syntax error:1:11: "str" invalid escape sequence "\q"`,
+		"a = 1\nstr = \"\\x4\"":            `syntax error:2:8: "str" invalid escape sequence "\x4"`,
+		`str = "\u30zz"`:                   `syntax error:1:8: "str" invalid escape sequence "\u30zz"`,
+		`str = "あ\uD800"`:                  `syntax error:1:9: "str" invalid unicode code point "\uD800"`,
+		`str = "\U00110000"`:               `syntax error:1:8: "str" invalid unicode code point "\U00110000"`,
+		"str = \"\"\"\nabc\n  \\z\n\"\"\"": `syntax error:3:3: "str" invalid escape sequence "\z"`,
+		`strs = ["a", "\e"]`:               `syntax error:1:15: "strs" invalid escape sequence "\e"`,
+	}
+	for test, msg := range tests {
+		_, err := Parse([]byte(test))
+		if err == nil || err.Error() != msg {
+			t.Errorf("%s: %v", test, err)
+		}
+	}
+}
+
+// raw 文字列、インデント除去付き複数行文字列の正常系テスト
+func TestNormalRawStringCase(t *testing.T) {
+	var strs = []string{
+		"path    = `C:\\Users\\app\\n` # comment",
+		"pattern = `^\\d+\"$`",
+		"raws    = [`\\t`, `a'b`]",
+		"raw     = ```",
+		"  \\n",
+		"```",
+		"dedent  = |\"\"\"",
+		"    SELECT *",
+		"      FROM users",
+		"",
+		"    WHERE id = \\u0031",
+		"    \"\"\"",
+		"folded  = >'''",
+		"    Hello",
+		"    World",
+		"",
+		"    Bye",
+		"'''",
+		"rawblk  = |```",
+		"\t\t\\n",
+		"\t\t  x",
+		"\t\t```",
+	}
+	var tests = map[string]string{
+		"path":    `C:\Users\app\n`,
+		"pattern": `^\d+"$`,
+		"raws":    `[\t a'b]`,
+		"raw":     "  \\n",
+		"dedent":  "SELECT *\n  FROM users\n\nWHERE id = 1",
+		"folded":  "Hello World\nBye",
+		"rawblk":  "\\n\n  x",
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %q != %q", key, data[key], value)
+		}
+	}
+}
+
+// raw 文字列、インデント除去付き複数行文字列の異常系テスト
+func TestErrorRawStringCase(t *testing.T) {
+	var tests = []string{
+		"str = `abc",
+		"str = `abc` x",
+		"str = |\"abc\"",
+		"str = |\"\"",
+		"str = >abc",
+		"str = |\"\"\"\n  \\q\n\"\"\"",
+	}
+	for _, test := range tests {
+		if _, err := Parse([]byte(test)); err == nil {
+			t.Error(test)
+		}
+	}
+}
+
+// 行継続の正常系テスト
+func TestNormalContinuationCase(t *testing.T) {
+	var strs = []string{
+		"str1  = \"Hello \\",
+		"        World\"",
+		"str2  = 'a\\",
+		"\t\tb'",
+		"int   = 1,000,\\",
+		"        000",
+		"dur   = 1h\\",
+		"        30m",
+		"key   = \\",
+		"        true",
+		"multi = \"\"\"a\\",
+		"b\"\"\"",
+		"raw   = ```a\\",
+		"b```",
+		"arr   = [1, \\",
+		"         2] # comment \\",
+		"str3  = \"\\\\\"",
+	}
+	var tests = map[string]string{
+		"str1":  "Hello World",
+		"str2":  "ab",
+		"int":   "1000000",
+		"dur":   "1h30m0s",
+		"key":   "true",
+		"multi": "ab",
+		"raw":   "a\\\nb",
+		"arr":   "[1 2]",
+		"str3":  `\`,
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %q != %q", key, data[key], value)
+		}
+	}
+
+	// 行継続した場合も、エラー表示の行番号は実際の行番号とする
+	_, err = Parse([]byte("a = 1\nb = 1,\\\n  000\nc = 1x"))
+	if err == nil || !strings.HasPrefix(err.Error(), "syntax error:4:") {
+		t.Error(err)
+	}
+	_, err = Parse([]byte("a = \"x\\\n  \\q\""))
+	if err == nil || !strings.HasPrefix(err.Error(), "syntax error:2:3:") {
+		t.Error(err)
+	}
+}
+
+// タブ、Unicode の空白、BOM の正常系テスト
+func TestNormalWhitespaceCase(t *testing.T) {
+	var strs = []string{
+		"\uFEFF# BOM",
+		"\tint\t=\t100\t# comment",
+		"float\u3000=\u30001.5\u00a0",
+		"bool =\ttrue\t",
+		"str  =\t\"a\tb\"\t# comment",
+		"env  =\t$WS_TEST\t",
+		"dur  = 1h ",
+		"ip   =\t127.0.0.1\t",
+		"arr  = [\t1,\u30002\t]",
+		"multi = \"\"\"\n\ta\u3000b\n\"\"\"",
+	}
+	var tests = map[string]string{
+		"int":   "100",
+		"float": "1.5",
+		"bool":  "true",
+		"str":   "a\tb",
+		"env":   "ws",
+		"dur":   "1h0m0s",
+		"ip":    "127.0.0.1",
+		"arr":   "[1 2]",
+		"multi": "\ta\u3000b",
+	}
+	os.Setenv("WS_TEST", "ws")
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %q != %q", key, data[key], value)
+		}
+	}
+}
+
+// 不正な UTF-8 の異常系テスト
+func TestErrorWhitespaceCase(t *testing.T) {
+	var tests = map[string]string{
+		"a = 1\nb = \"あ\xff\"": "syntax error:2:7: invalid UTF-8 encoding",
+		"# \xc3\na = 1":        "syntax error:1:3: invalid UTF-8 encoding",
+		"a = 1\t2":             "syntax error:1: \"a = 1\t2\" integer invalid value",
+		"a = tr\u3000ue":       "syntax error:1: \"a = tr\u3000ue\" boolean invalid value",
+	}
+	for test, msg := range tests {
+		_, err := Parse([]byte(test))
+		if err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+}
+
+// 引用符で囲まれたキー名、Unicode のキー名の正常系テスト
+func TestNormalQuotedKeyCase(t *testing.T) {
+	var strs = []string{
+		`hosts."api.example.com".weight = 10`,
+		`hosts.'db-1 primary'.port      = 5432`,
+		`hosts . "a=b" . Name           = "x"`,
+		`"top"                          = true`,
+		`escape."tab\there"             = 1`,
+		`日本.名前                      = "ok"`,
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")), UnicodeKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	hosts := data["hosts"].(map[string]interface{})
+	if fmt.Sprint(hosts["api.example.com"]) != "map[weight:10]" {
+		t.Error(hosts)
+	}
+	if fmt.Sprint(hosts["db-1 primary"]) != "map[port:5432]" {
+		t.Error(hosts)
+	}
+	if fmt.Sprint(hosts["a=b"]) != "map[name:x]" {
+		t.Error(hosts)
+	}
+	if data["top"] != true || fmt.Sprint(data["escape"]) != "map[tab\there:1]" {
+		t.Error(data)
+	}
+	if fmt.Sprint(data["日本"]) != "map[名前:ok]" {
+		t.Error(data)
+	}
+}
+
+// 引用符で囲まれたキー名、Unicode のキー名の異常系テスト
+func TestErrorQuotedKeyCase(t *testing.T) {
+	var tests = map[string]string{
+		`日本.名前 = 1`:                                  `syntax error:1: "日本.名前" key name is invalid`,
+		`hosts."a.b" = 1` + "\n" + `hosts."a.b" = 2`: `syntax error:2: "hosts."a.b"" already exists`,
+		`hosts."a.b" = 1` + "\n" + `hosts.'a.b' = 2`: `syntax error:2: "hosts."a.b"" already exists`,
+		`hosts."a" = 1` + "\n" + `hosts.a.b = 2`:     `syntax error:2: "hosts.a.b" already exists`,
+		`hosts."" = 1`:                               `syntax error:1: "hosts.""" key name is invalid`,
+		`hosts."a"b = 1`:                             `syntax error:1: "hosts."a"b" key name is invalid`,
+		`hosts."a = 1`:                               `syntax error:1: invalid configuration`,
+		`hosts.'a'. = 1`:                             `syntax error:1: "hosts.'a'." key name is invalid`,
+		`hosts."\q" = 1`:                             `syntax error:1: "hosts."\q"" key name is invalid`,
+	}
+	for test, msg := range tests {
+		_, err := Parse([]byte(test))
+		if err == nil || err.Error() != msg {
+			t.Errorf("%s: %v", test, err)
+		}
+	}
+	// UnicodeKeys オプション指定時も、数字から始まるキー名は不正とする
+	if _, err := Parse([]byte(`日本.１番 = 1`), UnicodeKeys()); err == nil {
+		t.Error("unicode key test failed")
+	}
+}
+
+// キー名の大文字、小文字を保持するオプションのテスト
+func TestKeyCaseCase(t *testing.T) {
+	// 小文字へ変換する場合 (既定値)
+	p, err := Parse([]byte("Flags.NewUI = true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Data()) != "map[_all_:map[flags:map[newui:true]]]" {
+		t.Error(p.Data())
+	}
+
+	var strs = []string{
+		"Headers.'X-Request-ID' = 1",
+		"Flags.NewUI = true",
+		"flags.newUI = false",
+	}
+	// 大文字、小文字を区別する場合は、別のキーとして扱う
+	p, err = Parse([]byte(strings.Join(strs, "\n")), CaseSensitive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Data()) != "map[_all_:map[Flags:map[NewUI:true] Headers:map[X-Request-ID:1] flags:map[newUI:false]]]" {
+		t.Error(p.Data())
+	}
+	// 大文字、小文字を保持し、重複は区別せずに判定する場合は、エラーとする
+	_, err = Parse([]byte(strings.Join(strs, "\n")), PreserveCase())
+	if err == nil || err.Error() != `syntax error:3: "flags.newUI" already exists` {
+		t.Error(err)
+	}
+	// 同じ階層のキーは、最初に記述した表記にまとめる
+	p, err = Parse([]byte("App.Name = 1\napp.Port = 2"), PreserveCase())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Data()) != "map[_all_:map[App:map[Name:1 Port:2]]]" {
+		t.Error(p.Data())
+	}
+}
+
+// [mode.prefix] 形式のセクションの正常系テスト
+func TestNormalSectionCase(t *testing.T) {
+	var strs = []string{
+		"app.name = \"global\"",
+		"[production]",
+		"app.name = \"prod\"",
+		"[production.http]",
+		"host = \"example.com\"",
+		"port = 443",
+		"[production.db.'primary-1']",
+		"host = \"db1\"",
+		"[_all_.http]",
+		"port = 80",
+		"[_all_]",
+		"debug = false",
+		"[development]",
+		"debug = true",
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = map[string]string{
+		"_all_":       "map[app:map[name:global] debug:false http:map[port:80]]",
+		"production":  "map[app:map[name:prod] db:map[primary-1:map[host:db1]] http:map[host:example.com port:443]]",
+		"development": "map[debug:true]",
+	}
+	data := p.Data().(map[string]interface{})
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %v != %s", key, data[key], value)
+		}
+	}
+	// 冒頭にモード指定が必要な場合も、[_all_] で全体設定領域を指定できる
+	p, err = ParseModeAll([]byte("[_all_.app]\nname = 1\n[test]\nname = 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Data()) != "map[_all_:map[app:map[name:1]] test:map[name:2]]" {
+		t.Error(p.Data())
+	}
+}
+
+// [mode.prefix] 形式のセクションの異常系テスト
+func TestErrorSectionCase(t *testing.T) {
+	var tests = map[string]string{
+		"[prod.http]\na = 1\n[prod.http]":        `syntax error:3: "prod.http" mode is already exists`,
+		"[prod]\nhttp.a = 1\n[prod.http]\na = 2": `syntax error:4: "http.a" already exists`,
+		"[prod.]":                                `syntax error:1: "prod." mode name is invalid`,
+		"[.http]":                                `syntax error:1: mode name is empty`,
+		"[_prod.http]":                           `syntax error:1: "_prod" can not specify '_' first character`,
+		"[prod.http..a]":                         `syntax error:1: "prod.http..a" mode name is invalid`,
+		"[_all_]\na = 1\n[_all_]":                `syntax error:3: "_all_" mode is already exists`,
+	}
+	for test, msg := range tests {
+		_, err := Parse([]byte(test))
+		if err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+}
+
+// key { ... } のブロック構文で、ネストした設定値を指定する
+func TestNormalBlockCase(t *testing.T) {
+	var strs = []string{
+		"http { port = 8080; tls { cert = \"a.pem\" } }",
+		"ws { a { b = 1 }; c = 2 } # コメント",
+		"db {",
+		"  # コメント",
+		"  host = \"localhost\" # } はコメントの一部",
+		"  pool.size = 10; names = [\"a\", \"b\"]",
+		"  'read-only' {",
+		"    timeout = 10s",
+		"  }",
+		"}",
+		"db.user = 'root;admin'",
+		"[production]",
+		"http {",
+		"  port = 443",
+		"}",
+		"[production.app]",
+		"log { level = \"warn\" }",
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = map[string]string{
+		"_all_":      "map[db:map[host:localhost names:[a b] pool:map[size:10] read-only:map[timeout:10s] user:root;admin] http:map[port:8080 tls:map[cert:a.pem]] ws:map[a:map[b:1] c:2]]",
+		"production": "map[app:map[log:map[level:warn]] http:map[port:443]]",
+	}
+	data := p.Data().(map[string]interface{})
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %v != %s", key, data[key], value)
+		}
+	}
+}
+
+// ブロック構文のエラー
+func TestErrorBlockCase(t *testing.T) {
+	var tests = map[string]string{
+		"http.port = 1\nhttp { port = 2 }": `syntax error:2: "http.port" already exists`,
+		"http { port = 1 }\nhttp.port = 2": `syntax error:2: "http.port" already exists`,
+		"http = 1\nhttp { port = 2 }":      `syntax error:2: "http.port" already exists`,
+		"http { tls {\nport = 1 }":         `syntax error: "http" block is not closed`,
+		"http { tls { port = 1":            `syntax error: "http.tls" block is not closed`,
+		"http = 1 }":                       `syntax error:1: "http = 1 }" integer invalid value`,
+		"}":                                `syntax error:1: unexpected "}"`,
+		"a = 1; b = 2":                     `syntax error:1: "a = 1;" integer invalid value`,
+		"http {\n[prod]\n}":                `syntax error:2: mode name can not be specified in block`,
+		"http { port = [1, 2 }":            `syntax error:1: "http.port = 2 }" integer invalid value`,
+		"http { port = 1 } x = 2":          `syntax error:1: unexpected text after "}"`,
+		"a { b { c = 1 } d = 2 }":          `syntax error:1: unexpected text after "}"`,
+		"a { b = 1 }\nc { d = 2 } [prod]":  `syntax error:2: unexpected text after "}"`,
+	}
+	for test, msg := range tests {
+		_, err := Parse([]byte(test))
+		if err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+}
+
+// キー名が重複した場合の扱い
+func TestDuplicateCase(t *testing.T) {
+	var conf = strings.Join([]string{
+		"a = 1",
+		"http = 1",
+		"http.port = 2",
+		"a = 3",
+		"http { port = 4 }",
+		"[prod]",
+		"a = 5",
+	}, "\n")
+	var tests = []struct {
+		opts     []Option
+		data     string
+		warnings string
+	}{
+		{
+			[]Option{LastWins()},
+			"map[_all_:map[a:3 http:map[port:4]] prod:map[a:5]]",
+			`[warning:3: "http.port" overrides the definition at line 2 warning:4: "a" overrides the definition at line 1 warning:5: "http.port" overrides the definition at line 3]`,
+		},
+		{
+			[]Option{FirstWins()},
+			"map[_all_:map[a:1 http:1] prod:map[a:5]]",
+			`[warning:3: "http.port" is ignored. already defined at line 2 warning:4: "a" is ignored. already defined at line 1 warning:5: "http.port" is ignored. already defined at line 2]`,
+		},
+		{
+			[]Option{LastWins(), PreserveCase()},
+			"map[_all_:map[a:3 http:map[port:4]] prod:map[a:5]]",
+			`[warning:3: "http.port" overrides the definition at line 2 warning:4: "a" overrides the definition at line 1 warning:5: "http.port" overrides the definition at line 3]`,
+		},
+	}
+	for _, test := range tests {
+		p, err := Parse([]byte(conf), test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(p.Data()) != test.data {
+			t.Errorf("%v != %s", p.Data(), test.data)
+		}
+		if fmt.Sprint(p.Warnings()) != test.warnings {
+			t.Errorf("%v != %s", p.Warnings(), test.warnings)
+		}
+	}
+	// 既定では、エラーとなる
+	if _, err := Parse([]byte(conf)); err == nil || err.Error() != `syntax error:3: "http.port" already exists` {
+		t.Error(err)
+	}
+	// 大文字、小文字を区別せずに判定し、先に定義したキー名の表記で上書きする
+	p, err := Parse([]byte("App.Name = 1\napp.name = 2"), LastWins(), PreserveCase())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Data()) != "map[_all_:map[App:map[Name:2]]]" || len(p.Warnings()) != 1 {
+		t.Error(p.Data(), p.Warnings())
+	}
+}
+
+// モード名、キー名を定義された順序で取得する
+func TestOrderCase(t *testing.T) {
+	var conf = strings.Join([]string{
+		"routes.users = \"/users\"",
+		"routes.admin = \"/admin\"",
+		"[production]",
+		"middleware { zlib = true; auth = true; log = true }",
+		"[development.routes]",
+		"z = 1",
+		"[_all_]",
+		"routes.about = \"/about\"",
+		"debug = false",
+	}, "\n")
+	p, err := Parse([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		keys   []string
+		expect string
+	}{
+		{[]string{"_all_"}, "[routes debug]"},
+		{[]string{"_all_", "routes"}, "[users admin about]"},
+		{[]string{"production", "middleware"}, "[zlib auth log]"},
+		{[]string{"development"}, "[routes]"},
+		{[]string{"development", "routes", "z"}, "[]"},
+		{[]string{"nomode"}, "[]"},
+	}
+	if fmt.Sprint(p.Modes()) != "[production development]" {
+		t.Error(p.Modes())
+	}
+	for _, test := range tests {
+		if keys := p.Keys(test.keys[0], test.keys[1:]...); fmt.Sprint(keys) != test.expect {
+			t.Errorf("%v: %v != %s", test.keys, keys, test.expect)
+		}
+	}
+	// 上書きされたキー名は、最初に定義された位置のまま、削除されたキー名は除外する
+	p, err = Parse([]byte("a = 1\nb.x = 1\nc = 1\nb = 2\na = 3"), LastWins())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Keys("_all_")) != "[a b c]" || p.Keys("_all_", "b") != nil {
+		t.Error(p.Keys("_all_"), p.Keys("_all_", "b"))
+	}
+	// 大文字、小文字を保持する場合は、先に定義したキー名の表記で返却する
+	p, err = Parse([]byte("Http.Port = 1\nhttp.Host = 2"), PreserveCase())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Keys("_all_", "HTTP")) != "[Port Host]" {
+		t.Error(p.Keys("_all_", "HTTP"))
+	}
+	// キーを持たないモード名も、宣言された順序で返却する
+	p, err = ParseModeAll([]byte("[staging]\n[production.http]\nport = 1\n[_all_]\na = 1\n[test]\n[production.db]\nhost = 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Modes()) != "[staging production test]" {
+		t.Error(p.Modes())
+	}
+}
+
+// io.Reader から読み込みながら解析する
+func TestReaderCase(t *testing.T) {
+	var tests = []string{
+		"\uFEFFapp.name = \"sample\"\r\napp.port = 8080\r\n",
+		"a = 1\rb = [\r\n  1,\r\n  2\r\n]\r",
+		"a = \"\"\"\nline1\nline2\n\"\"\"\nb = \\\n  10\n[prod]\nhttp { port = 80 }\n",
+		"  名前 = '値'\t# コメント\n",
+	}
+	for _, test := range tests {
+		p1, err := Parse([]byte(test), UnicodeKeys())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 1バイトずつ読み込んでも、同じ結果となる
+		p2, err := ParseReader(iotest.OneByteReader(strings.NewReader(test)), UnicodeKeys())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(p1.Data()) != fmt.Sprint(p2.Data()) {
+			t.Errorf("%q: %v != %v", test, p1.Data(), p2.Data())
+		}
+	}
+
+	// 解析済みの行は破棄するため、読み込み済みの文字列は一定のサイズに収まる
+	var buf bytes.Buffer
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&buf, "routes.r%d = \"/path/to/route/%d\"\n", i, i)
+	}
+	size := buf.Len()
+	p, err := ParseReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(p.Keys("_all_", "routes")); n != 100000 {
+		t.Fatal(n)
+	}
+	if cap(p.src.text) >= size/2 {
+		t.Errorf("buffer size %d, input size %d", cap(p.src.text), size)
+	}
+
+	// 破棄した行も含めて、行番号、桁番号を表示する
+	var errors = map[string]string{
+		"a = yes\n":     `syntax error:100001: "a" invalid value`,
+		"a = \"\\q\"\n": `syntax error:100001:6: "a" invalid escape sequence "\q"`,
+		"a = \xff\n":    `syntax error:100001:5: invalid UTF-8 encoding`,
+		"a = [\n1,\n":   `syntax error: invalid configuration. probably cause "a" parameters`,
+	}
+	for test, msg := range errors {
+		var buf bytes.Buffer
+		for i := 0; i < 100000; i++ {
+			fmt.Fprintf(&buf, "key%d = %d\n", i, i)
+		}
+		buf.WriteString(test)
+		if _, err := ParseReader(&buf); err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+	// 読み込みエラーは、そのまま返却する
+	if _, err := ParseModeAllReader(iotest.ErrReader(io.ErrUnexpectedEOF)); err != io.ErrUnexpectedEOF {
+		t.Error(err)
+	}
+}
+
+// ネストした配列
+func TestNestedArrayCase(t *testing.T) {
+	var tests = map[string]string{
+		"a = [[1, 2], [3]]":                           "[][]int [[1 2] [3]]",
+		"a = [[\"a\u3000b\", # ]\n 'c'], [\"d\te\"]]": "[][]string [[a\u3000b c] [d\te]]",
+		"a = [[[1.5]], [[2.5, 3.5], [4.5]]]":          "[][][]float64 [[[1.5]] [[2.5 3.5] [4.5]]]",
+		"a = [[true], \\\n  [false]]":                 "[][]bool [[true] [false]]",
+		"a = [[], [1]]":                               "[][]int [[] [1]]",
+		"a = [[1], []]":                               "[][]int [[1] []]",
+		"a = [[]]":                                    "[]interface {} [[]]",
+		"a = [[], []]":                                "[]interface {} [[] []]",
+		"a = [[[]], [[1], []]]":                       "[][][]int [[[]] [[1] []]]",
+		"a = " + strings.Repeat("[", 100) + "1" + strings.Repeat("]", 100): strings.Repeat("[]", 100) + "int " + strings.Repeat("[", 100) + "1" + strings.Repeat("]", 100),
+	}
+	for test, expect := range tests {
+		p, err := Parse([]byte(test))
+		if err != nil {
+			t.Fatal(test, err)
+		}
+		value := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})["a"]
+		if s := fmt.Sprintf("%T %v", value, value); s != expect {
+			t.Errorf("%q: %s != %s", test, s, expect)
+		}
+	}
+	var errors = map[string]string{
+		"a = [[1], [\"a\"]]": `syntax error:1: "a" array of different types are confused`,
+		"a = [[1], 2]":       `syntax error:1: "a" array of different types are confused`,
+		"a = [1, []]":        `syntax error:1: "a" array of different types are confused`,
+		"a = [[], 1]":        `syntax error:1: "a" array of different types are confused`,
+		"a = [[[]], [1]]":    `syntax error:1: "a" array of different types are confused`,
+		"a = [[1], [[]]]":    `syntax error:1: "a" array of different types are confused`,
+		"a = [[], ::1]":      `syntax error:1: "a" array of different types are confused`,
+		"a = [[1], [2]":      `syntax error: invalid configuration. probably cause "a" parameters`,
+	}
+	for test, msg := range errors {
+		if _, err := Parse([]byte(test)); err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+}
+
+// 値の種類によらず、空白、コメント、値の終わりを同じように扱うかのテスト
+func TestLexerCase(t *testing.T) {
+	os.Setenv("LEXER_TEST", "lexer")
+	var strs = []string{
+		"bool  = false # :an\t#",
+		"env   = $LEXER_TEST # comment",
+		"bools = [true # comment",
+		"  , false]",
+		"envs  = [$LEXER_TEST#, $HOME",
+		"  ]",
+		"ips   = [127.0.0.1 # comment",
+		"  , 10.0.0.1]",
+		"nums  = [1 # comment",
+		"  , 2]",
+	}
+	var tests = map[string]string{
+		"bool":  "false",
+		"env":   "lexer",
+		"bools": "[true false]",
+		"envs":  "[lexer]",
+		"ips":   "[127.0.0.1 10.0.0.1]",
+		"nums":  "[1 2]",
+	}
+	p, err := Parse([]byte(strings.Join(strs, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Data().(map[string]interface{})["_all_"].(map[string]interface{})
+	for key, value := range tests {
+		if fmt.Sprint(data[key]) != value {
+			t.Errorf("%s: %v != %s", key, data[key], value)
+		}
+	}
+
+	// エラーの内容は、値の種類毎の表記を維持する
+	var errors = map[string]string{
+		"a = 0xFFZ":               "syntax error:1: \"a = 0xFFZ...\" hex invalid value",
+		"a = 0699":                "syntax error:1: \"a = 069...\" oct invalid value",
+		"a = 100a":                "syntax error:1: \"a = 100a\" integer invalid value",
+		"a = +0":                  "syntax error:1: \"a = +0\" oct invalid value",
+		"a = 1,00 100":            "syntax error:1: \"a = 1,00 100\" integer invalid value",
+		"a = 1KBx":                "syntax error:1: \"a = 1KBx...\" size invalid error",
+		"a = 2018-12-01_00:01:02": "syntax error:1: \"a = 2018-12-01_...\" datetime invalid error",
+		"a = [1, tru]":            "syntax error:1: \"a = tru\" boolean invalid value",
+		"a = $ # comment":         "syntax error:1: \"a\" environ invalid value",
+		"a = 1.2.3.4 x":           "syntax error:1: \"a = 1.2.3.4 x\" network address invalid value",
+		"a = 0z":                  "syntax error:1: \"a\" invalid value",
+	}
+	for test, msg := range errors {
+		if _, err := Parse([]byte(test)); err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+}
+
+// 右辺値のみの解析のテスト
+func TestParseValueCase(t *testing.T) {
+	var tests = map[string]string{
+		"1":                     "1",
+		"[1,\n 2] # note":       "[1 2]",
+		"\"\"\"\na = 1\n\"\"\"": "a = 1",
+	}
+	for test, expect := range tests {
+		if v, err := ParseValue(test); err != nil || fmt.Sprint(v) != expect {
+			t.Errorf("%q: %v %v", test, v, err)
+		}
+	}
+	// 値以外のキーやモードを定義している場合は、エラーとする
+	for _, test := range []string{"1\nother = 2", "1\n[production]\na = 2", "1\n[production]", "1\napp { a = 2 }"} {
+		msg := fmt.Sprintf("syntax error: %q is not a single value", test)
+		if _, err := ParseValue(test); err == nil || err.Error() != msg {
+			t.Errorf("%q: %v", test, err)
+		}
+	}
+}
+
+func TestLimitCase(t *testing.T) {
+	var tests = []struct {
+		conf string
+		opt  Option
+		msg  string
+	}{
+		{"a = 1\nb = 2\n", MaxInputSize(8), `syntax error: input size exceeds the limit of 8 bytes`},
+		{"a.b.c = 1\n", MaxDepth(2), `syntax error:1: "a.b.c" nesting depth exceeds the limit of 2`},
+		{"a { b.c = 1 }\n", MaxDepth(2), `syntax error:1: "a.b.c" nesting depth exceeds the limit of 2`},
+		{"a = [[[1]]]\n", MaxDepth(2), `syntax error:1: "a" nesting depth exceeds the limit of 2`},
+		{"a = [1, 2, 3]\n", MaxArrayLength(2), `syntax error:1: "a" array length exceeds the limit of 2`},
+		{"a = \"abcd\"\n", MaxStringLength(3), `syntax error:1: "a" string length exceeds the limit of 3 bytes`},
+		{"a = \"\"\"\nabcd\n\"\"\"\n", MaxStringLength(3), `syntax error:3: "a" string length exceeds the limit of 3 bytes`},
+		{"a = [\"ab\", \"abcd\"]\n", MaxStringLength(3), `syntax error:1: "a" string length exceeds the limit of 3 bytes`},
+	}
+	for _, test := range tests {
+		if _, err := Parse([]byte(test.conf), test.opt); err == nil || err.Error() != test.msg {
+			t.Errorf("%q: %v", test.conf, err)
+		}
+		if _, err := ParseReader(iotest.OneByteReader(strings.NewReader(test.conf)), test.opt); err == nil || err.Error() != test.msg {
+			t.Errorf("reader %q: %v", test.conf, err)
+		}
+	}
+
+	// 上限ちょうどの場合は、エラーとしない
+	var valid = []struct {
+		conf string
+		opt  Option
+	}{
+		{"a = 1\nb = 2\n", MaxInputSize(12)},
+		{"a.b = [[1]]\n", MaxDepth(2)},
+		{"a = [1, 2]\n", MaxArrayLength(2)},
+		{"a = \"a\\tc\"\n", MaxStringLength(3)},
+	}
+	for _, test := range valid {
+		if _, err := Parse([]byte(test.conf), test.opt); err != nil {
+			t.Errorf("%q: %v", test.conf, err)
+		}
+	}
+}
+
+// 10万要素の配列
+func BenchmarkArray100k(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString("values = [")
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&buf, "%d, ", i)
+	}
+	buf.WriteString("]\n")
+	b.SetBytes(int64(buf.Len()))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(buf.Bytes()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 10万要素を持つ、ネストした配列
+func BenchmarkNestedArray100k(b *testing.B) {
+	var buf bytes.Buffer
+	buf.WriteString("values = [")
+	for i := 0; i < 25000; i++ {
+		fmt.Fprintf(&buf, "[[%d, %d], [%d, %d]], ", i, i, i, i)
+	}
+	buf.WriteString("]\n")
+	b.SetBytes(int64(buf.Len()))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(buf.Bytes()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 深くネストした配列
+func BenchmarkDeepArray(b *testing.B) {
+	const depth = 2000
+	var text = "values = " + strings.Repeat("[", depth) + "1, 2, 3" + strings.Repeat("]", depth) + "\n"
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse([]byte(text)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 様々な型の値を含む、一般的な設定ファイル
+func benchmarkConfig() []byte {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, "[mode%d]\n", i)
+		fmt.Fprintf(&buf, "# section %d\n", i)
+		fmt.Fprintf(&buf, "int     = %d # comment\n", i)
+		fmt.Fprintf(&buf, "float   = %d.5\n", i)
+		fmt.Fprintf(&buf, "hex     = 0x%X\n", i)
+		fmt.Fprintf(&buf, "bool    = %t\n", i%2 == 0)
+		fmt.Fprintf(&buf, "str     = \"value %d\\tescaped\"\n", i)
+		fmt.Fprintf(&buf, "raw     = 'value %d'\n", i)
+		fmt.Fprintf(&buf, "date    = 2018-12-01 00:01:02\n")
+		fmt.Fprintf(&buf, "timeout = 1h30m\n")
+		fmt.Fprintf(&buf, "size    = %dMB\n", i)
+		fmt.Fprintf(&buf, "env     = $HOME\n")
+		fmt.Fprintf(&buf, "addr    = 127.0.0.1:%d\n", 1024+i)
+		fmt.Fprintf(&buf, "array   = [%d, %d, %d]  # comment\n", i, i+1, i+2)
+		fmt.Fprintf(&buf, "strs    = [\"a\", 'b', \"c\"]\n")
+		fmt.Fprintf(&buf, "app.name.first = \"name\"\n")
+	}
+	return buf.Bytes()
+}
+
+// 様々な型の値を含む設定ファイルの解析
+func BenchmarkParse(b *testing.B) {
+	var text = benchmarkConfig()
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseModeAll(text); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 任意の入力に対して、パニックせずに値、またはエラーを返却するかのテスト
+func FuzzParse(f *testing.F) {
+	// ../test 配下の設定ファイルを、シードとして使用する
+	files, _ := filepath.Glob("../test/*.conf")
+	for _, file := range files {
+		if buf, err := os.ReadFile(file); err == nil {
+			f.Add(buf)
+		}
+	}
+	for _, seed := range []string{
+		"= 1",
+		"a = 1",
+		"[mode]\na.b = [1, [2, 3], []]",
+		"a { b = 1; c { d = \"x\" } }",
+		"a = \"\"\"\nmulti\n\"\"\"",
+		"a = |'''\n  text\n  '''",
+		"a = 0x_FF # comment",
+		"a = 1h30m\nb = 1.5GiB\nc = 2018-12-01T00:01:02Z",
+		"a = [::1]:8080\nb = [10.0.0.0/8, 127.0.0.1]",
+		"a = $HOME\nb = inf\nc = -nan",
+		"a = \"\\u00e9\\x41\" \\\n",
+		"'a.b'.\"c\" = `raw`",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		p, err := Parse(buf)
+		if err == nil && p.Data() == nil {
+			t.Fatal("no data and no error")
+		}
+		ParseReader(bytes.NewReader(buf), LastWins())
+		ParseModeAll(buf, PreserveCase(), ExactNumbers())
+		ParseReader(bytes.NewReader(buf), MaxInputSize(256), MaxDepth(4), MaxArrayLength(4), MaxStringLength(8))
+	})
+}
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// io.Reader から一度に読み込むバイト数。解析済みの行は、このサイズを超えた時点で破棄する
+const chunkSize = 64 * 1024
+
+// source 構造体は、解析する文字列を管理する。io.Reader から解析する場合は、解析の進行に合わせて読み込み、破棄する
+type source struct {
+	text    []byte    // 読み込み済みの文字列
+	r       io.Reader // 読み込み元。すべて読み込んだ場合は nil
+	buf     []byte    // 読み込み用のバッファ
+	line    int       // 破棄した行数
+	size    int       // io.Reader から読み込んだバイト数
+	ready   int       // 次の行まで読み込み済みであることが保証される位置
+	checked int       // UTF-8 のチェックが完了した位置
+	bom     bool      // 先頭の BOM の判定が完了した場合 true
+	cr      bool      // 直前に読み込んだ文字が \r の場合 true
+}
+
+// 親ノードの source を取得する。独自に実装されたノードの場合は、Text の内容から生成する
+func sourceOf(p Node) *source {
+	if v, ok := p.(interface{ source() *source }); ok && v.source() != nil {
+		return v.source()
+	}
+	return &source{text: p.Text()}
+}
+
+// バイト列から source を生成する
+func newSource(buf []byte) (*source, error) {
+	// 先頭の BOM は除去する
+	src := &source{bom: true}
+	buf = bytes.TrimPrefix(buf, []byte("\uFEFF"))
+	// CR+LF, CR 対策
+	src.text = append(src.normalize(make([]byte, 0, len(buf)+1), buf), '\n')
+	// 不正な UTF-8 の文字列は、エラーとする
+	if offset, ok := validUTF8(src.text); !ok {
+		line, col := position(src.text, offset)
+		return nil, fmt.Errorf("syntax error:%d:%d: invalid UTF-8 encoding", line, col)
+	}
+	return src, nil
+}
+
+// io.Reader から読み込む source を生成する
+func newReaderSource(r io.Reader) *source {
+	return &source{r: r}
+}
+
+// CR+LF, CR を LF へ変換して dst へ追加する。\r\n が読み込みの境界で分割された場合も考慮する
+func (src *source) normalize(dst, buf []byte) []byte {
+	for _, c := range buf {
+		if src.cr && c == '\n' {
+			src.cr = false
+			continue
+		}
+		src.cr = c == '\r'
+		if c == '\r' {
+			c = '\n'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// 改行コードを n 個以上含むか判定する
+func hasLines(text []byte, n int) bool {
+	for ; n > 0; n-- {
+		i := bytes.IndexByte(text, '\n')
+		if i < 0 {
+			return false
+		}
+		text = text[i+1:]
+	}
+	return true
+}
+
+// 不正な UTF-8 の文字列が含まれる場合、その位置を返却する
+func validUTF8(text []byte) (int, bool) {
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i, false
+		}
+		i += size
+	}
+	return 0, true
+}
+
+// 位置 i の行と、その次の行を読み込む。値の解析中ではない行頭の場合は、解析済みの行を破棄する。
+// 破棄した場合は、破棄後の i の位置を返却する
+func (p *Parser) fill(i int) (int, error) {
+	src := p.src
+	if src.r == nil || i < src.ready {
+		return i, nil
+	}
+	// 解析済みの行を破棄する
+	if i >= chunkSize && src.text[i-1] == '\n' && p.node == nil && p.stat == ParserNone {
+		src.line += bytes.Count(src.text[:i], []byte("\n"))
+		src.text = src.text[:copy(src.text, src.text[i:])]
+		src.checked -= i
+		i = 0
+	}
+	// 次の行の終わりまで読み込む
+	for src.r != nil && !hasLines(src.text[i:], 2) {
+		if src.buf == nil {
+			src.buf = make([]byte, chunkSize)
+		}
+		n, err := src.r.Read(src.buf)
+		src.size += n
+		if err := p.option().limitSize(src.size); err != nil {
+			return i, err
+		}
+		src.text = src.normalize(src.text, src.buf[:n])
+		if err == io.EOF {
+			src.r = nil
+			src.text = append(src.text, '\n')
+		} else if err != nil {
+			return i, err
+		}
+		// 先頭の BOM は除去する
+		if !src.bom && (len(src.text) >= 3 || src.r == nil) {
+			src.bom = true
+			src.text = bytes.TrimPrefix(src.text, []byte("\uFEFF"))
+		}
+	}
+	// 読み込み済みの行の、不正な UTF-8 の文字列は、エラーとする
+	end := bytes.LastIndexByte(src.text, '\n') + 1
+	if offset, ok := validUTF8(src.text[src.checked:end]); !ok {
+		return i, p.error(&positionError{src.checked + offset, fmt.Errorf("invalid UTF-8 encoding")})
+	}
+	src.checked = end
+	// 次の行の開始位置までは、再度読み込む必要はない
+	if src.r != nil {
+		src.ready = i + bytes.IndexByte(src.text[i:], '\n') + 1
+	} else {
+		src.ready = len(src.text)
+	}
+	return i, nil
+}
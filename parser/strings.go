@@ -2,45 +2,45 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // String 構造体は、環境変数を解析する
 type String struct {
-	Value
-	keep  int
+	lexer
 	quote byte
 	prev  [3]byte
-	array bool
+	block byte // |""" の場合 '|'、>""" の場合 '>'
+	skip  int  // 読み飛ばす文字数
 }
 
 // NewString 関数は、文字列解析用ノードを生成する
 func NewString(p Node) Node {
 	text := p.Text()
 	cnt := p.Getidx()
-	_, ok := p.(*Array)
-	return &String{
-		Value: Value{
-			text: text,
-			stat: ParserBeginString,
-			cnt:  cnt,
-			pos:  p.Pos(),
-			end:  p.End(),
-			key:  p.Keyname(),
-		},
-		array: ok,
-		quote: text[cnt],
+	str := &String{lexer: newLexer(p, ParserBeginString), quote: text[cnt]}
+	// |""", >""" の場合は、先頭の引用符を読み飛ばして、複数行文字列として解析する
+	if isBlockString(text, cnt) {
+		str.quote = text[cnt+1]
+		str.block = text[cnt]
+		str.skip = 1
 	}
+	return str
 }
 
 // Analyze 関数は、文字列解析を実施する
 func (str *String) Analyze(b byte) (i interface{}, err error) {
 	// コメント行があった場合は、スルーする
-	if str.stat == ParserComment {
-		if b != '\n' {
-			return
-		}
-		str.stat = str.keep
+	if str.comment(b) {
+		return
+	}
+	// |""", >""" の先頭の引用符は読み飛ばす
+	if str.skip > 0 {
+		str.skip--
+		str.end = str.cnt + 1
+		return
 	}
 	switch str.stat {
 	// 文字列を解析
@@ -61,33 +61,157 @@ func (str *String) Analyze(b byte) (i interface{}, err error) {
 
 // Param 関数は、先頭、最後尾の改行を1つだけ除去した結果を返却する
 func (str *String) Param() string {
-	// 値を取得
-	param := strings.Trim(str.Value.Param(), " ")
-
-	if str.quote == '"' {
-		// " の場合、\\n, \\t, \\" を置き換える
-		params := strings.Split(param, "\\\\")
-		for i, v := range params {
-			v = strings.Replace(v, "\\n", "\n", -1)
-			v = strings.Replace(v, "\\t", "\t", -1)
-			v = strings.Replace(v, `\"`, "\"", -1)
-			params[i] = v
-		}
-		param = strings.Join(params, "\\")
-	} else if str.quote == 39 {
-		// ' の場合、\' を置き換える
-		param = strings.Replace(param, `\'`, "'", -1)
-	}
-	// 先頭、最後尾の" or 'を除去する
-	param = str.Trim(param, str.quote)
-	// 複数行文字列の場合
+	param, _ := str.param()
+	return param
+}
+
+// 解析した文字列を返却する。MaxStringLength の上限を超えた場合はエラーとする
+func (str *String) value() (string, error) {
+	param, err := str.param()
+	if err != nil {
+		return "", err
+	}
+	if err := str.limitString(len(param)); err != nil {
+		return "", err
+	}
+	return param, nil
+}
+
+// 引用符を除去し、エスケープシーケンスを展開した文字列を返却する
+func (str *String) param() (string, error) {
+	// 値を取得し、値の先頭の設定ファイル内の位置を求める
+	raw := string(str.Text()[str.pos:str.end])
+	param := strings.TrimLeftFunc(raw, isSpace)
+	offset := str.pos + len(raw) - len(param)
+	param = strings.TrimRightFunc(param, isSpace)
+	// |""", >""" の場合は、先頭の | or > を除去する
+	if str.block != 0 && param != "" {
+		param = param[1:]
+		offset++
+	}
+
+	// 先頭、最後尾の" or 'を除去する。複数行文字列の場合は、3つずつ除去し、先頭、最後尾の改行を1つだけ除去する
+	var trims = []byte{str.quote}
 	if str.stat == ParserMultiEndString {
-		param = str.Trim(param, str.quote)
-		param = str.Trim(param, str.quote)
-		param = str.Trim(param, '\n')
+		trims = []byte{str.quote, str.quote, str.quote, '\n'}
+	}
+	for _, c := range trims {
+		if param != "" && param[0] == c {
+			param = param[1:]
+			offset++
+		}
+		if param != "" && param[len(param)-1] == c {
+			param = param[:len(param)-1]
+		}
 	}
 
-	return param
+	// |""", >""" の場合は、共通のインデントを除去する
+	if str.block != 0 {
+		// エスケープシーケンスの誤りは、インデント除去前の位置で報告する
+		if str.quote == '"' {
+			if _, err := str.unescape(param, offset); err != nil {
+				return "", err
+			}
+		}
+		param = dedent(param)
+		if str.block == '>' {
+			param = fold(param)
+		}
+	}
+
+	switch str.quote {
+	// " の場合、エスケープシーケンスを展開する
+	case '"':
+		return str.unescape(param, offset)
+	// ' の場合、\' を置き換える。行継続は、複数行文字列以外の場合のみ扱う
+	case 39:
+		if str.stat != ParserMultiEndString {
+			param = joinLines(param)
+		}
+		return strings.Replace(param, `\'`, "'", -1), nil
+	}
+	return param, nil
+}
+
+// 1文字のエスケープシーケンス
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'a':  '\a',
+	'b':  '\b',
+	'f':  '\f',
+	'v':  '\v',
+	'"':  '"',
+	'\\': '\\',
+}
+
+// エスケープシーケンスを展開する。offset は、param の先頭の設定ファイル内の位置
+func (str *String) unescape(param string, offset int) (string, error) {
+	if strings.IndexByte(param, '\\') == -1 {
+		return param, nil
+	}
+	var buf = make([]byte, 0, len(param))
+	for i := 0; i < len(param); i++ {
+		if param[i] != '\\' {
+			buf = append(buf, param[i])
+			continue
+		}
+		var seq = param[i:]
+		if len(seq) > 2 {
+			seq = seq[:2]
+		}
+		if len(param) == i+1 {
+			return "", &positionError{offset + i, fmt.Errorf("\"%s\" invalid escape sequence \"%s\"", str.key, seq)}
+		}
+		c := param[i+1]
+		// 行末の \ は、改行と次の行の先頭の空白を除去する
+		if c == '\n' {
+			i++
+			for i+1 < len(param) && (param[i+1] == ' ' || param[i+1] == '\t') {
+				i++
+			}
+			continue
+		}
+		if v, ok := escapes[c]; ok {
+			buf = append(buf, v)
+			i++
+			continue
+		}
+		// \xHH, \uXXXX, \UXXXXXXXX
+		var size int
+		switch c {
+		case 'x':
+			size = 2
+		case 'u':
+			size = 4
+		case 'U':
+			size = 8
+		default:
+			return "", &positionError{offset + i, fmt.Errorf("\"%s\" invalid escape sequence \"%s\"", str.key, seq)}
+		}
+		if len(param) < i+2+size {
+			seq = param[i:]
+		} else {
+			seq = param[i : i+2+size]
+		}
+		v, err := strconv.ParseUint(seq[2:], 16, 32)
+		if err != nil || len(seq) != 2+size {
+			return "", &positionError{offset + i, fmt.Errorf("\"%s\" invalid escape sequence \"%s\"", str.key, seq)}
+		}
+		if c == 'x' {
+			// \xHH は、1バイトの値として扱う
+			buf = append(buf, byte(v))
+		} else {
+			if !utf8.ValidRune(rune(v)) {
+				return "", &positionError{offset + i, fmt.Errorf("\"%s\" invalid unicode code point \"%s\"", str.key, seq)}
+			}
+			buf = utf8.AppendRune(buf, rune(v))
+		}
+		i += 1 + size
+	}
+	return string(buf), nil
 }
 
 // 文字列解析開始処理
@@ -99,7 +223,7 @@ func (str *String) parseBeginString(b byte) (interface{}, error) {
 	// 閉じ"があった場合、終了処理へ移行する
 	case str.quote:
 		// \" ではない場合、終了処理となる
-		if str.Prev(1) != '\\' {
+		if !str.escaped() {
 			str.stat = ParserEndString
 			str.end = str.cnt + 1
 		}
@@ -110,22 +234,38 @@ func (str *String) parseBeginString(b byte) (interface{}, error) {
 	return nil, nil
 }
 
+// 現在の引用符が、エスケープされているか判定する。" の場合は、\\" を閉じ"として扱う
+func (str *String) escaped() bool {
+	// ` の場合は、エスケープシーケンスを使用しない
+	if str.quote == '`' {
+		return false
+	}
+	if str.quote != '"' {
+		return str.Prev(1) == '\\'
+	}
+	var n int
+	for str.cnt-n-1 > str.pos && str.Text()[str.cnt-n-1] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
+
 // 文字列解析終了処理
 func (str *String) parseEndString(b byte) (interface{}, error) {
-	switch b {
-	// 改行があった場合、終了
-	case '\n':
+	switch {
+	// 改行、配列内の , ] があった場合、終了
+	case str.terminator(b):
 		// 状態を元に戻す
 		str.stat = ParserNone
-		// 不正な指定方法であった場合エラーとする
-		// if str.end < str.pos {
-		//	return nil, fmt.Errorf("\"%s\" string invalid value", str.key)
-		// }
+		// |""", >""" は、複数行文字列のみ指定できる
+		if str.block != 0 {
+			return nil, fmt.Errorf("\"%s\" string invalid value", str.key)
+		}
 		// パラメータを取得
-		return str.Param(), nil
+		return str.value()
 	// 閉じ"の後に、再度"があった場合
-	case str.quote:
-		if str.Prev(2) == str.quote && str.Prev(1) == str.quote && b == str.quote {
+	case b == str.quote:
+		if str.Prev(2) == str.quote && str.Prev(1) == str.quote {
 			// 3つ連続で"があった場合は、複数行文字列としてみなす
 			str.stat = ParserMultiBeginString
 			str.end = str.cnt + 1
@@ -134,21 +274,12 @@ func (str *String) parseEndString(b byte) (interface{}, error) {
 			return nil, fmt.Errorf("\"%s\" string invalid value", str.key)
 		}
 	// コメント行
-	case '#':
-		str.stat = ParserComment
-		str.keep = ParserEndString
+	case b == '#':
+		str.skipLine()
 	// 空白はスルーする
-	case ' ':
-	// 上記以外
+	case b == ' ':
+	// 上記以外はエラーとする
 	default:
-		// 配列の場合、, または]があった時点で終了とする
-		if str.array {
-			if b == ',' || b == ']' {
-				str.end = str.cnt
-				return str.Analyze('\n')
-			}
-		}
-		// エラーとする
 		return nil, fmt.Errorf("\"%s\" string invalid value", str.key)
 	}
 	return nil, nil
@@ -159,8 +290,8 @@ func (str *String) parseMultiBeginString(b byte) (interface{}, error) {
 	str.end = str.cnt + 1
 
 	if str.prev[1] == str.quote && str.prev[0] == str.quote && b == str.quote {
-		// \""" となっていた場合は、まだ終了ではない
-		if str.prev[2] != '\\' {
+		// \""" となっていた場合は、まだ終了ではない。``` の場合は、エスケープシーケンスを使用しない
+		if str.prev[2] != '\\' || str.quote == '`' {
 			str.stat = ParserMultiEndString
 		}
 	}
@@ -173,35 +304,87 @@ func (str *String) parseMultiBeginString(b byte) (interface{}, error) {
 
 // 複数行文字列解析終了
 func (str *String) parseMultiEndString(b byte) (interface{}, error) {
-	switch b {
-	// 改行があった時点で、終了とする
-	case '\n':
-		// 不正な指定方法であった場合エラーとする
-		// if str.end < str.pos {
-		//	return nil, fmt.Errorf("\"%s\" string invalid value", str.key)
-		// }
-		param := str.Param()
+	switch {
+	// 改行、配列内の , ] があった時点で、終了とする
+	case str.terminator(b):
+		param, err := str.value()
 		// 状態を元に戻す
 		str.stat = ParserNone
-		return param, nil
-	// 空白はスルー
-	case ' ':
+		return param, err
 	// コメント行
-	case '#':
-		str.end = str.cnt
-		str.stat = ParserComment
-		str.keep = ParserMultiEndString
-	// 上記以外
+	case b == '#':
+		str.skipLine()
+	// 空白はスルー
+	case b == ' ':
+	// 上記以外はエラーとする
 	default:
-		// 配列の場合、, または]があった時点で終了とする
-		if str.array {
-			if b == ',' || b == ']' {
-				str.end = str.cnt
-				return str.Analyze('\n')
-			}
-		}
-		// エラーとする
 		return nil, fmt.Errorf("\"%s\" string invalid value", str.key)
 	}
 	return nil, nil
 }
+
+// 値の先頭が、|""", >""" 形式の複数行文字列か判定する
+func isBlockString(text []byte, cnt int) bool {
+	if cnt+4 > len(text) || (text[cnt] != '|' && text[cnt] != '>') {
+		return false
+	}
+	switch string(text[cnt+1 : cnt+4]) {
+	case `"""`, "'''", "```":
+		return true
+	}
+	return false
+}
+
+// 空白、タブのみの行か判定する
+func isBlankLine(line string) bool {
+	return strings.Trim(line, " \t") == ""
+}
+
+// 各行に共通するインデントを除去する。最終行が空白のみの場合は、閉じ引用符のインデントとみなし除去する
+func dedent(param string) string {
+	lines := strings.Split(param, "\n")
+	if len(lines) > 1 && isBlankLine(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	// 空行を除いた各行で、共通するインデントを求める
+	var indent string
+	var found bool
+	for _, line := range lines {
+		if isBlankLine(line) {
+			continue
+		}
+		prefix := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			indent, found = prefix, true
+			continue
+		}
+		for !strings.HasPrefix(prefix, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	for i, line := range lines {
+		if isBlankLine(line) {
+			lines[i] = ""
+		} else {
+			lines[i] = line[len(indent):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 改行を空白へ置き換え、各行を連結する。空行は改行として扱う
+func fold(param string) string {
+	lines := strings.Split(param, "\n")
+	var buf strings.Builder
+	for i, line := range lines {
+		switch {
+		case i == 0:
+		case line == "":
+			buf.WriteByte('\n')
+		case lines[i-1] != "":
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(line)
+	}
+	return buf.String()
+}
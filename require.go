@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ochipin/config/internal/lookup"
+)
+
+// 指定されたキーが、data 内に存在するかチェックする。fold が true の場合は、大文字、小文字を区別しない
+func exists(data map[string]interface{}, keys []string, fold bool) bool {
+	for i, key := range keys {
+		v, ok := data[lookup.Key(data, key, fold)]
+		if !ok {
+			return false
+		}
+		if i == len(keys)-1 {
+			break
+		}
+		if data, ok = v.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// 構造体の required タグ、及び Require オプションで指定されたキーが、全て存在するかチェックする。
+// 省略可能なセクションの required タグは、セクションが存在する場合のみチェックする
+func required(data map[string]interface{}, i interface{}, o *options) ([]string, error) {
+	var keys []string
+	if typeof := structtype(i); typeof != nil {
+		err := walkfields(typeof, nil, func(field reflect.StructField, fieldtype reflect.Type, names []string) error {
+			if tag, ok := field.Tag.Lookup("required"); ok && tag != "false" {
+				keys = append(keys, strings.Join(names, "."))
+			}
+			if absent(data, field, fieldtype, names, !o.caseSensitive) {
+				return errSkipFields
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Require オプションのキー名は、CaseSensitive オプション指定時以外は小文字として扱う
+	for _, key := range o.required {
+		if !o.caseSensitive {
+			key = strings.ToLower(key)
+		}
+		keys = append(keys, key)
+	}
+
+	// 存在しないキーを、重複なしで列挙する
+	var missing []string
+	var found = make(map[string]bool)
+	for _, key := range keys {
+		if found[key] {
+			continue
+		}
+		found[key] = true
+		if !exists(data, strings.Split(key, "."), !o.caseSensitive) {
+			missing = append(missing, key)
+		}
+	}
+	return missing, nil
+}
+
+// 必須キーが存在しない場合、エラーを返却する
+func checkrequired(data map[string]interface{}, i interface{}, o *options, mode string) error {
+	missing, err := required(data, i, o)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+	if mode != "" {
+		return fmt.Errorf("missing required keys in \"%s\" mode: %s", mode, strings.Join(missing, ", "))
+	}
+	return fmt.Errorf("missing required keys: %s", strings.Join(missing, ", "))
+}
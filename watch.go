@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PollInterval オプションの指定がない場合の、ポーリングの間隔
+const pollInterval = time.Second
+
+// Watcher 構造体は、設定ファイルの変更を監視し、変更があった場合に再読み込みする。
+// 読み込みに成功した場合のみ、Load が返却する値を置き換える
+type Watcher struct {
+	path     string
+	mode     string
+	typ      reflect.Type // 再読み込み時に生成する値の型
+	opts     []Option
+	interval time.Duration // 0 以外の場合、inotify を使用せずにポーリングする
+
+	value    atomic.Value // 最後に読み込みに成功した値
+	err      atomic.Value // 最後の再読み込みのエラー。watchError 型で格納する
+	mu       sync.Mutex   // 再読み込み、コールバックの登録を排他する
+	info     os.FileInfo  // 最後に読み込んだ時点の設定ファイルの情報
+	changes  []func(old, new interface{})
+	failures []func(err error)
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// atomic.Value は nil を格納できないため、エラーを構造体で包む
+type watchError struct {
+	err error
+}
+
+// NewWatcher 関数は、path の設定ファイルを i へ格納し、設定ファイルの監視を開始する。
+// 変更があった場合は、mode を指定して i と同じ型の新しい値へ格納し直す。
+// Linux では inotify、それ以外の環境、または PollInterval オプション指定時はポーリングで監視する
+func NewWatcher(path, mode string, i interface{}, opts ...Option) (*Watcher, error) {
+	valueof := reflect.ValueOf(i)
+	if valueof.Kind() != reflect.Ptr || valueof.IsNil() {
+		return nil, fmt.Errorf("watcher error. missing arguments")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := Parse(path, mode, i, opts...); err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		path:     path,
+		mode:     mode,
+		typ:      valueof.Type().Elem(),
+		opts:     opts,
+		interval: newOptions(opts).interval,
+		info:     info,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	w.value.Store(i)
+	go w.run()
+	return w, nil
+}
+
+// Load 関数は、最後に読み込みに成功した値を返却する。値の型は、NewWatcher に指定した i と同じ型となる
+func (w *Watcher) Load() interface{} {
+	return w.value.Load()
+}
+
+// Err 関数は、最後の再読み込みに失敗した場合、そのエラーを返却する。成功した場合は nil を返却する
+func (w *Watcher) Err() error {
+	if v, ok := w.err.Load().(watchError); ok {
+		return v.err
+	}
+	return nil
+}
+
+// OnChange 関数は、再読み込みに成功した場合に呼び出す関数を登録する。old には置き換える前の値、new には新しい値を渡す。
+// 登録した関数内から、Reload, OnChange, OnError を呼び出さないこと
+func (w *Watcher) OnChange(fn func(old, new interface{})) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.changes = append(w.changes, fn)
+}
+
+// OnError 関数は、再読み込みに失敗した場合に呼び出す関数を登録する。失敗した場合、Load は以前の値を返却する
+func (w *Watcher) OnError(fn func(err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failures = append(w.failures, fn)
+}
+
+// Reload 関数は、設定ファイルの変更の有無に関わらず、設定ファイルを再読み込みする
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// 読み込み中の変更を見逃さないよう、読み込む前に設定ファイルの情報を取得する
+	if info, err := os.Stat(w.path); err == nil {
+		w.info = info
+	}
+	i := reflect.New(w.typ).Interface()
+	err := Parse(w.path, w.mode, i, w.opts...)
+	w.err.Store(watchError{err})
+	if err != nil {
+		for _, fn := range w.failures {
+			fn(err)
+		}
+		return err
+	}
+	old := w.value.Load()
+	w.value.Store(i)
+	for _, fn := range w.changes {
+		fn(old, i)
+	}
+	return nil
+}
+
+// Close 関数は、設定ファイルの監視を終了する
+func (w *Watcher) Close() error {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+	return nil
+}
+
+// 設定ファイルの監視処理。inotify を使用できない場合は、ポーリングで監視する
+func (w *Watcher) run() {
+	defer close(w.done)
+	if w.interval == 0 && w.notify() {
+		return
+	}
+	w.poll()
+}
+
+// 一定の間隔で、設定ファイルの変更の有無をチェックする
+func (w *Watcher) poll() {
+	interval := w.interval
+	if interval == 0 {
+		interval = pollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// 設定ファイルの更新日時、サイズ、実体のいずれかが変わっていた場合、再読み込みする。
+// 置き換え中等で設定ファイルが存在しない場合は、次の変更を待つ。再読み込みのエラーは、Err, OnError で参照する
+func (w *Watcher) check() {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	prev := w.info
+	w.mu.Unlock()
+	if info.ModTime().Equal(prev.ModTime()) && info.Size() == prev.Size() && os.SameFile(info, prev) {
+		return
+	}
+	w.Reload()
+}
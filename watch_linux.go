@@ -0,0 +1,45 @@
+//go:build linux
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// inotify で設定ファイルを監視する。inotify を使用できない場合は false を返却する。
+// エディタや Kubernetes の ConfigMap はファイルを置き換えて更新するため、ファイルではなくディレクトリを監視する
+func (w *Watcher) notify() bool {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return false
+	}
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(w.path), syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO); err != nil {
+		syscall.Close(fd)
+		return false
+	}
+	// 非ブロッキングの fd は、Close で Read の待機を解除できる
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-w.stop
+		f.Close()
+	}()
+
+	// 監視を開始するまでの間の変更を反映する
+	w.check()
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if _, err := f.Read(buf); err != nil {
+			// Close 以外で読み込めなくなった場合は、ポーリングへ切り替える
+			select {
+			case <-w.stop:
+				return true
+			default:
+				return false
+			}
+		}
+		// 同じディレクトリ内の別のファイルの場合は、check で読み飛ばす
+		w.check()
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package config
+
+// inotify を使用できない環境では、ポーリングで監視する
+func (w *Watcher) notify() bool {
+	return false
+}